@@ -7,19 +7,77 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/karthik446/social/internal/auth"
+	"github.com/karthik446/social/internal/mailer"
 	"github.com/karthik446/social/internal/store"
 )
 
 type application struct {
-	config config
-	store  store.Storage
+	config        config
+	store         store.Storage
+	authenticator auth.Authenticator
+	mailer        mailer.Client
+	timelineJobs  chan timelineJob
 }
 
 type config struct {
-	addr    string
-	db      dbConfig
-	env     string
-	version string
+	addr        string
+	db          dbConfig
+	env         string
+	version     string
+	auth        authConfig
+	mail        mailConfig
+	frontendURL string
+	feed        feedConfig
+	scheduler   schedulerConfig
+	softDelete  softDeleteConfig
+	trending    trendingConfig
+	// requireIfMatch makes If-Match mandatory on post edits and deletes.
+	requireIfMatch bool
+	// mergeEditConflicts retries post edits that lost a race against another
+	// edit, as long as the two changed different fields.
+	mergeEditConflicts bool
+}
+
+type trendingConfig struct {
+	interval       time.Duration
+	recentWindow   time.Duration
+	baselineWindow time.Duration
+	minCount       int
+	limit          int
+}
+
+type softDeleteConfig struct {
+	graceWindow   time.Duration
+	retention     time.Duration
+	purgeInterval time.Duration
+	batchSize     int
+}
+
+type schedulerConfig struct {
+	interval  time.Duration
+	batchSize int
+}
+
+type feedConfig struct {
+	queueSize          int
+	fanOutMaxFollowers int
+}
+
+type mailConfig struct {
+	exp       time.Duration
+	fromEmail string
+	dir       string
+}
+
+type authConfig struct {
+	token tokenConfig
+}
+
+type tokenConfig struct {
+	secret string
+	exp    time.Duration
+	iss    string
 }
 
 type dbConfig struct {
@@ -44,32 +102,113 @@ func (app *application) mount() *chi.Mux {
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/health", app.healthCheckHandler)
 
+		r.Route("/authentication", func(r chi.Router) {
+			r.Post("/user", app.registerUserHandler)
+			r.Post("/token", app.createTokenHandler)
+		})
+
 		r.Route("/posts", func(r chi.Router) {
-			// r.Get("/", app.listPostsHandler)
-			r.Post("/", app.createPostHandler)
+			r.With(app.optionalAuthTokenMiddleware).Get("/", app.listPostsHandler)
+			r.With(app.authTokenMiddleware).Post("/", app.createPostHandler)
 			r.Route("/{id}", func(r chi.Router) {
-				r.Use(app.postsContextMiddleware)
+				// A deleted post cannot be loaded into the context, so restoring
+				// it sits outside postsContextMiddleware.
+				r.With(app.authTokenMiddleware).Post("/restore", app.restorePostHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.optionalAuthTokenMiddleware)
+					r.Use(app.postsContextMiddleware)
+
+					r.Get("/", app.getPostHandler)
+					r.Get("/comments", app.listCommentsHandler)
+					r.Get("/revisions", app.listPostRevisionsHandler)
+					r.Get("/revisions/diff", app.diffPostRevisionsHandler)
+					r.Get("/revisions/{version}", app.getPostRevisionHandler)
 
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.updatePostHandler)
-				r.Delete("/", app.deletePostHandler)
+					r.Group(func(r chi.Router) {
+						r.Use(app.authTokenMiddleware)
 
-				r.Post("/comments", app.createCommentHandler)
-				r.Get("/comments", app.listCommentsHandler)
-				r.Delete("/comments/{commentId}", app.deleteCommentHandler)
-				r.Patch("/comments/{commentId}", app.updateCommentHandler)
+						r.Patch("/", app.checkPostOwnership("moderator", app.checkPostIfMatch(app.updatePostHandler)))
+						r.Delete("/", app.checkPostOwnership("moderator", app.checkPostIfMatch(app.deletePostHandler)))
+						r.Post("/publish", app.checkPostOwnership("admin", app.publishPostHandler))
+						r.Post("/revisions/{version}/revert", app.revertPostHandler)
+
+						r.Put("/reactions", app.putReactionHandler)
+						r.Delete("/reactions", app.deleteReactionHandler)
+
+						r.Post("/repost", app.repostHandler)
+						r.Delete("/repost", app.undoRepostHandler)
+
+						r.Put("/bookmark", app.putBookmarkHandler)
+						r.Delete("/bookmark", app.deleteBookmarkHandler)
+
+						r.Post("/comments", app.createCommentHandler)
+						r.Route("/comments/{commentId}", func(r chi.Router) {
+							r.Use(app.commentsContextMiddleware)
+
+							r.Patch("/", app.checkCommentOwnership("moderator", app.updateCommentHandler))
+							r.Delete("/", app.checkCommentOwnership("moderator", app.deleteCommentHandler))
+
+							r.Post("/replies", app.createReplyHandler)
+						})
+					})
+				})
+			})
+		})
+
+		r.With(app.optionalAuthTokenMiddleware).Get("/search", app.searchHandler)
+
+		r.Route("/tags", func(r chi.Router) {
+			r.Use(app.optionalAuthTokenMiddleware)
+			r.Get("/trending", app.listTrendingTagsHandler)
+			r.Get("/{tag}/posts", app.listTagPostsHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
+				r.Put("/{tag}/follow", app.followTagHandler)
+				r.Delete("/{tag}/follow", app.unfollowTagHandler)
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
+			r.Put("/activate/{token}", app.activateUserHandler)
+
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
+				r.Patch("/", app.updateMeHandler)
+				r.Get("/drafts", app.listDraftsHandler)
+				r.Get("/mentions", app.listMentionsHandler)
+
+				r.Get("/bookmarks", app.listBookmarksHandler)
+				r.Get("/bookmarks/collections", app.listBookmarkCollectionsHandler)
+				r.Post("/bookmarks/collections", app.createBookmarkCollectionHandler)
+				r.Delete("/bookmarks/collections/{collectionId}", app.deleteBookmarkCollectionHandler)
+			})
+
 			r.Route("/{id}", func(r chi.Router) {
 				r.Use(app.usersContextMiddleware)
-				r.Get("/", app.getUserHandler)
+				r.With(app.optionalAuthTokenMiddleware).Get("/", app.getUserHandler)
+				r.Get("/followers", app.listFollowersHandler)
+				r.Get("/following", app.listFollowingHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.authTokenMiddleware)
+
+					r.Put("/follow", app.followUserHandler)
+					r.Put("/unfollow", app.unfollowUserHandler)
+
+					r.Put("/block", app.blockUserHandler)
+					r.Put("/unblock", app.unblockUserHandler)
+					r.Put("/mute", app.muteUserHandler)
+					r.Put("/unmute", app.unmuteUserHandler)
 
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+					r.Get("/follow-requests", app.listFollowRequestsHandler)
+					r.Post("/follow-requests/{requesterId}/accept", app.acceptFollowRequestHandler)
+					r.Post("/follow-requests/{requesterId}/reject", app.rejectFollowRequestHandler)
+				})
 			})
 			r.Group(func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
 				r.Get("/feed", app.getUserFeedHandler)
 			})
 		})
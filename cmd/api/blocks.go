@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	blocker := getAuthUserFromCtx(r)
+	blocked := getUserFromCtx(r)
+
+	if blocker.ID == blocked.ID {
+		app.badRequestResponse(w, r, errors.New("you cannot block yourself"))
+		return
+	}
+
+	if err := app.store.Blocks.Block(r.Context(), blocker.ID, blocked.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.enqueueTimelineJob(timelineJob{kind: timelineRemoveAuthor, userID: blocker.ID, authorID: blocked.ID})
+	app.enqueueTimelineJob(timelineJob{kind: timelineRemoveAuthor, userID: blocked.ID, authorID: blocker.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	blocker := getAuthUserFromCtx(r)
+	blocked := getUserFromCtx(r)
+
+	if err := app.store.Blocks.Unblock(r.Context(), blocker.ID, blocked.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	muter := getAuthUserFromCtx(r)
+	muted := getUserFromCtx(r)
+
+	if muter.ID == muted.ID {
+		app.badRequestResponse(w, r, errors.New("you cannot mute yourself"))
+		return
+	}
+
+	if err := app.store.Mutes.Mute(r.Context(), muter.ID, muted.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	muter := getAuthUserFromCtx(r)
+	muted := getUserFromCtx(r)
+
+	if err := app.store.Mutes.Unmute(r.Context(), muter.ID, muted.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,9 +1,8 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"errors"
-	"log"
 	"net/http"
 	"strconv"
 
@@ -11,10 +10,14 @@ import (
 	"github.com/karthik446/social/internal/store"
 )
 
+const commentContextKey contextKey = "comment"
+
 type CreateCommentPayload struct {
 	Content string `json:"content" validate:"required,max=1000"`
-	PostID  int64  `json:"post_id"`
-	UserID  int64  `json:"user_id"`
+}
+
+type CreateReplyPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
 }
 
 type UpdateCommentPayload struct {
@@ -32,25 +35,24 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	_, err := app.store.Posts.GetById(r.Context(), payload.PostID)
-	if err != nil {
-		switch {
-		case errors.Is(err, store.ErrNotFound):
-			app.notFoundResponse(w, r, err)
-		default:
-			app.internalServerError(w, r, err)
-		}
-	}
+	user := getAuthUserFromCtx(r)
 
+	// The post in the URL has already been checked to be visible to the
+	// caller, so it is the only one the comment may go to.
 	comment := &store.Comment{
 		Content: payload.Content,
-		PostID:  payload.PostID,
-		UserID:  1,
+		PostID:  getPostFromCtx(r).ID,
+		UserID:  user.ID,
 	}
 
 	ctx := r.Context()
 	if err := app.store.Comments.Create(ctx, comment); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -61,26 +63,25 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 }
 
 func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
-	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentId"), 10, 64)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
+	comment := getCommentFromCtx(r)
 
 	ctx := r.Context()
-	if err := app.store.Comments.DeleteById(ctx, commentID); err != nil {
+	if err := app.store.Comments.DeleteById(ctx, comment.ID); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
+		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
 	var payload UpdateCommentPayload
 	if err := readJSON(w, r, &payload); err != nil {
 		app.badRequestResponse(w, r, err)
@@ -91,30 +92,18 @@ func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentId"), 10, 64)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+	if payload.Content != "" {
+		comment.Content = payload.Content
 	}
 
-	comment, err := app.store.Comments.GetById(r.Context(), commentID)
-	log.Println(err)
-	if err != nil {
+	ctx := r.Context()
+	if err := app.store.Comments.Update(ctx, comment); err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
-	}
-	log.Println("comment", comment)
-	log.Println("payload", payload)
-
-	comment.Content = payload.Content
-
-	ctx := r.Context()
-	if err := app.store.Comments.Update(ctx, comment); err != nil {
-		app.internalServerError(w, r, err)
 		return
 	}
 
@@ -125,21 +114,133 @@ func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Requ
 }
 
 func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
-	postID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	post := getPostFromCtx(r)
+
+	ct, err := defaultCommentTreeQuery().Parse(r)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
+	if err := validate.Struct(ct); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	ctx := r.Context()
-	comments, err := app.store.Comments.GetByPostID(ctx, postID)
+	// Replies can only be listed under a parent that is still visible.
+	if ct.ParentID != nil {
+		parent, err := app.store.Comments.GetById(ctx, *ct.ParentID)
+		if err == nil && parent.PostID != post.ID {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	comments, err := app.store.Comments.GetByPostID(ctx, post.ID, getAuthUserIDFromCtx(r), ct)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if err := app.attachCommentMentions(ctx, comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	if err := app.jsonResponse(w, http.StatusOK, comments); err != nil {
+	if err := app.paginatedJSONResponse(w, http.StatusOK, comments, store.CommentCursors(ct, comments)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
+
+func (app *application) createReplyHandler(w http.ResponseWriter, r *http.Request) {
+	parent := getCommentFromCtx(r)
+
+	var payload CreateReplyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getAuthUserFromCtx(r)
+
+	reply := &store.Comment{
+		Content:  payload.Content,
+		PostID:   parent.PostID,
+		ParentID: &parent.ID,
+		UserID:   user.ID,
+	}
+
+	ctx := r.Context()
+	if err := app.store.Comments.Create(ctx, reply); err != nil {
+		switch {
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, reply); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func defaultCommentTreeQuery() store.CommentTreeQuery {
+	return store.CommentTreeQuery{
+		Limit:  20,
+		Offset: 0,
+		Depth:  3,
+		Sort:   "newest",
+	}
+}
+
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		post := getPostFromCtx(r)
+
+		commentID, err := strconv.ParseInt(chi.URLParam(r, "commentId"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		comment, err := app.store.Comments.GetById(ctx, commentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if comment.PostID != post.ID {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentContextKey, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentContextKey).(*store.Comment)
+	return comment
+}
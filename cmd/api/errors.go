@@ -24,3 +24,29 @@ func (app *application) duplicateKeyConflict(w http.ResponseWriter, r *http.Requ
 	log.Printf("duplicate-key-conflict path: %s, method:%s,  %s", r.URL.Path, r.Method, err)
 	writeJSONError(w, http.StatusConflict, err.Error())
 }
+
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	log.Printf("edit-conflict-error path: %s, method:%s", r.URL.Path, r.Method)
+	writeJSONError(w, http.StatusConflict, "the post was modified by another request, please fetch it and try again")
+}
+
+func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("unauthorized-error path: %s, method:%s,  %s", r.URL.Path, r.Method, err)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="restricted"`)
+	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+}
+
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request) {
+	log.Printf("forbidden-error path: %s, method:%s", r.URL.Path, r.Method)
+	writeJSONError(w, http.StatusForbidden, "forbidden")
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	log.Printf("precondition-failed-error path: %s, method:%s", r.URL.Path, r.Method)
+	writeJSONError(w, http.StatusPreconditionFailed, "the resource has been modified since it was last fetched")
+}
+
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	log.Printf("precondition-required-error path: %s, method:%s", r.URL.Path, r.Method)
+	writeJSONError(w, http.StatusPreconditionRequired, "an If-Match header is required")
+}
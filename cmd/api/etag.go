@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/karthik446/social/internal/store"
+)
+
+// postETag derives a post's entity tag from its version, which every edit,
+// publish and restore bumps. It is what If-Match has to name.
+func postETag(post *store.Post) string {
+	return strconv.Quote(strconv.Itoa(post.Version))
+}
+
+// bodyETag derives a weak entity tag from the JSON encoding of data. It
+// validates responses that also carry what a version bump does not track,
+// such as comments, counts and the caller's own reactions.
+func bodyETag(data any) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// etagMatches reports whether etag is in the comma separated list of an
+// If-None-Match header. It uses the weak comparison RFC 9110 prescribes for
+// that header: weak tags compare by their opaque part.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatchesStrong is etagMatches for If-Match headers, which RFC 9110
+// requires to use strong comparison: a weak tag never matches.
+func etagMatchesStrong(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPostIfMatch only lets the request through when its If-Match header
+// names the current version of the post, as given by postETag, so clients cannot overwrite edits
+// they have not seen. The header is optional unless requireIfMatch is set.
+func (app *application) checkPostIfMatch(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		post := getPostFromCtx(r)
+
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch == "" {
+			if app.config.requireIfMatch {
+				app.preconditionRequiredResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !etagMatchesStrong(ifMatch, postETag(post)) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -24,14 +24,24 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	user := getAuthUserFromCtx(r)
+
 	ctx := r.Context()
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(4), fq)
+	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if err := app.attachReactions(ctx, feed, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.attachMentions(ctx, feed); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	if err := app.paginatedJSONResponse(w, http.StatusOK, feed, store.FeedCursors(fq, feed)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
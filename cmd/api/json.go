@@ -5,12 +5,16 @@ import (
 	"net/http"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/karthik446/social/internal/store"
 )
 
 var validate *validator.Validate
 
 func init() {
 	validate = validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return store.ValidUsername(fl.Field().String())
+	})
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -43,3 +47,11 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 	}
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+func (app *application) paginatedJSONResponse(w http.ResponseWriter, status int, data any, cursors store.PageCursors) error {
+	type envelope struct {
+		Data any `json:"data"`
+		store.PageCursors
+	}
+	return writeJSON(w, status, &envelope{Data: data, PageCursors: cursors})
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/karthik446/social/internal/auth"
 	"github.com/karthik446/social/internal/db"
 	"github.com/karthik446/social/internal/env"
+	"github.com/karthik446/social/internal/mailer"
 	"github.com/karthik446/social/internal/store"
 )
 
@@ -26,6 +30,51 @@ func main() {
 		},
 		env:     env.GetString("ENV", "development"),
 		version: env.GetString("VERSION", "1.0.0"),
+		auth: authConfig{
+			token: tokenConfig{
+				secret: env.GetString("AUTH_TOKEN_SECRET", ""),
+				exp:    time.Hour * 24 * 3,
+				iss:    "social",
+			},
+		},
+		mail: mailConfig{
+			exp:       time.Hour * 24 * 3,
+			fromEmail: env.GetString("MAIL_FROM_EMAIL", "no-reply@social.local"),
+			dir:       env.GetString("MAIL_DIR", ""),
+		},
+		frontendURL: env.GetString("FRONTEND_URL", "http://localhost:5173"),
+		feed: feedConfig{
+			queueSize:          env.GetInt("FEED_QUEUE_SIZE", 1024),
+			fanOutMaxFollowers: env.GetInt("FEED_FANOUT_MAX_FOLLOWERS", 10_000),
+		},
+		scheduler: schedulerConfig{
+			interval:  time.Second * time.Duration(env.GetInt("SCHEDULER_INTERVAL_SECONDS", 30)),
+			batchSize: env.GetInt("SCHEDULER_BATCH_SIZE", 100),
+		},
+		softDelete: softDeleteConfig{
+			graceWindow:   time.Hour * time.Duration(env.GetInt("SOFT_DELETE_GRACE_HOURS", 24*7)),
+			retention:     time.Hour * time.Duration(env.GetInt("SOFT_DELETE_RETENTION_HOURS", 24*30)),
+			purgeInterval: time.Minute * time.Duration(env.GetInt("SOFT_DELETE_PURGE_INTERVAL_MINUTES", 60)),
+			batchSize:     env.GetInt("SOFT_DELETE_PURGE_BATCH_SIZE", 500),
+		},
+		trending: trendingConfig{
+			interval:       time.Minute * time.Duration(env.GetInt("TRENDING_REFRESH_MINUTES", 5)),
+			recentWindow:   time.Minute * time.Duration(env.GetInt("TRENDING_RECENT_WINDOW_MINUTES", 60)),
+			baselineWindow: time.Hour * time.Duration(env.GetInt("TRENDING_BASELINE_WINDOW_HOURS", 24)),
+			minCount:       env.GetInt("TRENDING_MIN_COUNT", 3),
+			limit:          env.GetInt("TRENDING_LIMIT", 20),
+		},
+		requireIfMatch:     env.GetBool("REQUIRE_IF_MATCH", false),
+		mergeEditConflicts: env.GetBool("MERGE_EDIT_CONFLICTS", false),
+	}
+
+	// Only development may fall back to a well-known secret; anywhere else
+	// tokens signed with it could be forged by anyone.
+	if cfg.auth.token.secret == "" {
+		if cfg.env != "development" {
+			log.Fatal("AUTH_TOKEN_SECRET must be set")
+		}
+		cfg.auth.token.secret = "example"
 	}
 
 	database, err := db.New(cfg.db.addr, cfg.db.maxOpenConns, cfg.db.maxIdleConns, cfg.db.maxIdleTime)
@@ -40,12 +89,31 @@ func main() {
 	}(database)
 	log.Println("Connected to db")
 	postgresStorage := store.NewPostgresStorage(database)
+	store.FanOutMaxFollowers = cfg.feed.fanOutMaxFollowers
 
 	log.Println("Starting server on", cfg.addr)
+	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.iss, cfg.auth.token.iss)
+
+	localMailer, err := mailer.NewLocalMailer(cfg.mail.fromEmail, cfg.mail.dir)
+	if err != nil {
+		log.Fatalf("error creating mailer: %v", err)
+	}
+
 	app := &application{
-		config: cfg,
-		store:  postgresStorage,
+		config:        cfg,
+		store:         postgresStorage,
+		authenticator: jwtAuthenticator,
+		mailer:        localMailer,
+		timelineJobs:  make(chan timelineJob, cfg.feed.queueSize),
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.runTimelineWorker(ctx)
+	go app.runPostScheduler(ctx)
+	go app.runPurger(ctx)
+	go app.runTrendingRefresher(ctx)
+
 	mux := app.mount()
 
 	log.Fatal(app.run(mux))
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/karthik446/social/internal/store"
+)
+
+// listMentionsHandler lists the posts and comments that mention the caller.
+func (app *application) listMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	mq := store.MentionQuery{Limit: 20}
+	mq, err := mq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := validate.Struct(mq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	mentions, err := app.store.Mentions.GetByUserID(r.Context(), user.ID, mq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, mentions, store.MentionCursors(mq, mentions)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) attachMentions(ctx context.Context, feed []store.Feed) error {
+	posts := make([]*store.Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
+	return app.store.Mentions.LoadForPosts(ctx, posts)
+}
+
+// attachCommentMentions fills in the mentions of every comment in the tree.
+func (app *application) attachCommentMentions(ctx context.Context, comments []store.Comment) error {
+	all := make([]*store.Comment, 0, len(comments))
+	var walk func(cs []store.Comment)
+	walk = func(cs []store.Comment) {
+		for i := range cs {
+			all = append(all, &cs[i])
+			walk(cs[i].Replies)
+		}
+	}
+	walk(comments)
+	return app.store.Mentions.LoadForComments(ctx, all)
+}
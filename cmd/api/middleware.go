@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/karthik446/social/internal/store"
+)
+
+const authUserContextKey contextKey = "authUser"
+
+func (app *application) authTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Already authenticated further up the chain.
+		if getAuthUserFromCtx(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") == "" {
+			app.unauthorizedErrorResponse(w, r, errors.New("authorization header is missing"))
+			return
+		}
+
+		app.authenticate(w, r, next)
+	})
+}
+
+// optionalAuthTokenMiddleware authenticates the caller when an Authorization
+// header is present and lets anonymous requests through otherwise. Handlers
+// behind it must cope with getAuthUserFromCtx returning nil.
+func (app *application) optionalAuthTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.authenticate(w, r, next)
+	})
+}
+
+func (app *application) authenticate(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		app.unauthorizedErrorResponse(w, r, errors.New("authorization header is malformed"))
+		return
+	}
+
+	jwtToken, err := app.authenticator.ValidateToken(parts[1])
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	sub, err := jwtToken.Claims.GetSubject()
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+	userID, err := strconv.ParseInt(sub, 10, 64)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("invalid subject claim: %w", err))
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetById(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if !user.IsActive {
+		app.unauthorizedErrorResponse(w, r, errors.New("user is not activated"))
+		return
+	}
+
+	ctx = context.WithValue(ctx, authUserContextKey, user)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func getAuthUserFromCtx(r *http.Request) *store.User {
+	user, _ := r.Context().Value(authUserContextKey).(*store.User)
+	return user
+}
+
+// getAuthUserIDFromCtx returns the caller's id, or 0 for anonymous requests.
+func getAuthUserIDFromCtx(r *http.Request) int64 {
+	if user := getAuthUserFromCtx(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// checkPostOwnership lets the post's author through, and anyone else only if
+// their role is at least requiredRole.
+func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromCtx(r)
+		post := getPostFromCtx(r)
+
+		if post.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.checkRolePrecedence(w, r, user, requiredRole, next)
+	}
+}
+
+// checkCommentOwnership lets the comment's author through, and anyone else
+// only if their role is at least requiredRole.
+func (app *application) checkCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromCtx(r)
+		comment := getCommentFromCtx(r)
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.checkRolePrecedence(w, r, user, requiredRole, next)
+	}
+}
+
+func (app *application) checkRolePrecedence(w http.ResponseWriter, r *http.Request, user *store.User, roleName string, next http.HandlerFunc) {
+	role, err := app.store.Roles.GetByName(r.Context(), roleName)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if user.Role.Level < role.Level {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
@@ -3,25 +3,33 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
-	"reflect"
+	"slices"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/karthik446/social/internal/store"
 )
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title      string     `json:"title" validate:"required,max=100"`
+	Content    string     `json:"content" validate:"required,max=1000"`
+	Tags       []string   `json:"tags" validate:"omitempty,dive,max=255"`
+	Visibility string     `json:"visibility" validate:"omitempty,oneof=public followers only_me"`
+	Status     string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt  *time.Time `json:"publish_at"`
+	// QuotedPostID makes the post a quote of another one.
+	QuotedPostID *int64 `json:"quoted_post_id"`
 }
 
 type UpdatePostPayload struct {
-	Title   string   `json:"title" validate:"omitempty,max=100"`
-	Content string   `json:"content" validate:"omitempty,max=1000"`
-	Tags    []string `json:"tags"`
+	Title      string   `json:"title" validate:"omitempty,max=100"`
+	Content    string   `json:"content" validate:"omitempty,max=1000"`
+	Tags       []string `json:"tags" validate:"omitempty,dive,max=255"`
+	Visibility string   `json:"visibility" validate:"omitempty,oneof=public followers only_me"`
 }
 
 type contextKey string
@@ -39,18 +47,56 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  1,
+	if payload.PublishAt != nil && payload.Status == "" {
+		payload.Status = store.StatusScheduled
+	}
+	publishAt, err := schedulePublishAt(payload.Status, payload.PublishAt)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
+	user := getAuthUserFromCtx(r)
 	ctx := r.Context()
+
+	if payload.QuotedPostID != nil {
+		quoted, err := app.store.Posts.GetById(ctx, *payload.QuotedPostID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+		var visible bool
+		if quoted != nil {
+			visible, err = app.canViewPost(ctx, user, quoted)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+		if !visible || quoted.Status != store.StatusPublished {
+			app.badRequestResponse(w, r, errors.New("the quoted post does not exist"))
+			return
+		}
+	}
+
+	post := &store.Post{
+		Title:        payload.Title,
+		Content:      payload.Content,
+		Tags:         payload.Tags,
+		UserID:       user.ID,
+		Visibility:   payload.Visibility,
+		Status:       payload.Status,
+		PublishAt:    publishAt,
+		QuotedPostID: payload.QuotedPostID,
+	}
+
 	if err := app.store.Posts.Create(ctx, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if post.Status == store.StatusPublished {
+		app.enqueueTimelineJob(timelineJob{kind: timelineFanOutPost, postID: post.ID})
+	}
 
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -58,15 +104,98 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+func (app *application) listPostsHandler(w http.ResponseWriter, r *http.Request) {
+	lq, err := defaultPostsListQuery().Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.writePostsList(w, r, lq)
+}
+
+func defaultPostsListQuery() store.PostsListQuery {
+	return store.PostsListQuery{
+		PaginatedFeedQuery: store.PaginatedFeedQuery{
+			Limit:  20,
+			Offset: 0,
+			Sort:   "desc",
+		},
+	}
+}
+
+// writePostsList validates lq and responds with the page of posts it
+// selects.
+func (app *application) writePostsList(w http.ResponseWriter, r *http.Request, lq store.PostsListQuery) {
+	if err := validate.Struct(lq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	posts, err := app.store.Posts.List(ctx, getAuthUserIDFromCtx(r), lq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.attachReactions(ctx, posts, getAuthUserIDFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.attachMentions(ctx, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, posts, store.FeedCursors(lq.PaginatedFeedQuery, posts)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
-	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID)
+	ctx := r.Context()
+	comments, err := app.store.Comments.GetByPostID(ctx, post.ID, getAuthUserIDFromCtx(r), defaultCommentTreeQuery())
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 	post.Comments = comments
+	if err := app.attachCommentMentions(ctx, post.Comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Mentions.LoadForPosts(ctx, []*store.Post{post}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	count, err := app.store.Comments.CountByPostID(ctx, post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	post.CommentsCount = count
+
+	if err := app.attachPostReactions(ctx, post, getAuthUserIDFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// The body holds more than the version tracks, so it is validated by a
+	// hash of itself rather than by postETag.
+	etag, err := bodyETag(post)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -88,43 +217,140 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	base := *post
+	ctx := r.Context()
+	var err error
+	// An update that changes nothing must not bump the version, which would
+	// invalidate every client's ETag and archive a duplicate revision.
+	if applyPostUpdate(post, payload) {
+		err = app.store.Posts.Update(ctx, post)
+	}
+	// A client that stated the version it edits with If-Match gets exactly
+	// that, never a merge onto a newer one.
+	ifMatch := r.Header.Get("If-Match") != ""
+	if errors.Is(err, store.ErrEditConflict) && app.config.mergeEditConflicts && !ifMatch {
+		post, err = app.mergePostUpdate(ctx, &base, payload)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrEditConflict) && ifMatch:
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, store.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	// only_me posts are never fanned out, so followers' timelines have to
+	// catch up once the post becomes visible to them.
+	if base.Visibility == store.VisibilityOnlyMe && post.Visibility != store.VisibilityOnlyMe && post.Status == store.StatusPublished {
+		app.enqueueTimelineJob(timelineJob{kind: timelineFanOutPost, postID: post.ID})
+	}
+	if err := app.attachPostReactions(ctx, post, getAuthUserFromCtx(r).ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", postETag(post))
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// applyPostUpdate copies the fields set in payload onto post and reports
+// whether any of them changed.
+func applyPostUpdate(post *store.Post, payload UpdatePostPayload) bool {
+	changed := false
 	if payload.Title != "" && payload.Title != post.Title {
 		post.Title = payload.Title
+		changed = true
 	}
 	if payload.Content != "" && payload.Content != post.Content {
 		post.Content = payload.Content
+		changed = true
+	}
+	if payload.Visibility != "" && payload.Visibility != post.Visibility {
+		post.Visibility = payload.Visibility
+		changed = true
+	}
+	if tags := store.NormalizeTags(payload.Tags); len(tags) > 0 && !sameTags(post.ExplicitTags, tags) {
+		post.ExplicitTags = tags
+		changed = true
 	}
-	if len(payload.Tags) > 0 {
-		currentTags := make([]string, len(post.Tags))
-		newTags := make([]string, len(post.Tags))
-		copy(currentTags, post.Tags)
-		copy(newTags, post.Tags)
-		sort.Strings(currentTags)
-		sort.Strings(newTags)
-		if !reflect.DeepEqual(currentTags, newTags) {
+	return changed
+}
 
-			post.Tags = payload.Tags
-		}
+// mergePostUpdate retries an update that lost the race against another edit
+// of base by replaying the payload onto the latest version of the post. It
+// gives up with ErrEditConflict when both edits changed the same field.
+func (app *application) mergePostUpdate(ctx context.Context, base *store.Post, payload UpdatePostPayload) (*store.Post, error) {
+	latest, err := app.store.Posts.GetById(ctx, base.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	overlaps := func(set bool, baseValue, latestValue, newValue string) bool {
+		return set && baseValue != latestValue && newValue != latestValue
+	}
+	overlapsTags := func(newTags, baseTags, latestTags []string) bool {
+		return len(newTags) > 0 && !sameTags(baseTags, latestTags) && !sameTags(newTags, latestTags)
 	}
+	if overlaps(payload.Title != "", base.Title, latest.Title, payload.Title) ||
+		overlaps(payload.Content != "", base.Content, latest.Content, payload.Content) ||
+		overlaps(payload.Visibility != "", base.Visibility, latest.Visibility, payload.Visibility) ||
+		overlapsTags(store.NormalizeTags(payload.Tags), base.ExplicitTags, latest.ExplicitTags) {
+		return nil, store.ErrEditConflict
+	}
+
+	if !applyPostUpdate(latest, payload) {
+		return latest, nil
+	}
+	if err := app.store.Posts.Update(ctx, latest); err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// sameTags reports whether a and b hold the same tags, in any order.
+func sameTags(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	sort.Strings(a)
+	sort.Strings(b)
+	return slices.Equal(a, b)
+}
 
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	// Deleting only the version checked against If-Match keeps an edit made
+	// in between from being thrown away unseen.
+	err := app.store.Posts.DeleteById(r.Context(), post.ID, post.Version)
+	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, store.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.internalServerError(w, r, err)
 		}
-		return
-	}
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
-		app.internalServerError(w, r, err)
 		return
 	}
 
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
+// restorePostHandler undoes the deletion of one of the caller's posts, as
+// long as it happened within the grace window.
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
 	idParam := chi.URLParam(r, "id")
 	postID, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
@@ -132,21 +358,130 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	user := getAuthUserFromCtx(r)
 	ctx := r.Context()
-	err = app.store.Posts.DeleteById(ctx, postID)
-
-	if err != nil {
+	if err := app.store.Posts.Restore(ctx, postID, user.ID, app.config.softDelete.graceWindow); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
+		return
+	}
 
+	post, err := app.store.Posts.GetById(ctx, postID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.attachPostReactions(ctx, post, user.ID); err != nil {
+		app.internalServerError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("ETag", postETag(post))
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type PublishPostPayload struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// publishPostHandler publishes a draft or scheduled post now, or schedules it
+// when the body carries a publish_at.
+func (app *application) publishPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	var payload PublishPostPayload
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	status := store.StatusPublished
+	if payload.PublishAt != nil {
+		status = store.StatusScheduled
+	}
+	publishAt, err := schedulePublishAt(status, payload.PublishAt)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Posts.Publish(r.Context(), post, publishAt); err != nil {
+		switch {
+		case errors.Is(err, store.ErrAlreadyPublished):
+			app.duplicateKeyConflict(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if post.Status == store.StatusPublished {
+		app.enqueueTimelineJob(timelineJob{kind: timelineFanOutPost, postID: post.ID})
+	}
+	if err := app.attachPostReactions(r.Context(), post, getAuthUserFromCtx(r).ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", postETag(post))
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) listDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	dq := store.DraftQuery{Limit: 20}
+	dq, err := dq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := validate.Struct(dq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	drafts, err := app.store.Posts.GetDrafts(r.Context(), user.ID, dq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, drafts, store.DraftCursors(dq, drafts)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// schedulePublishAt checks the publish time that goes with status and
+// formats it for the store. Only scheduled posts carry one, and it must lie
+// in the future.
+func schedulePublishAt(status string, publishAt *time.Time) (*string, error) {
+	if status != store.StatusScheduled {
+		if publishAt != nil {
+			return nil, fmt.Errorf("publish_at is only allowed for scheduled posts")
+		}
+		return nil, nil
+	}
+	if publishAt == nil {
+		return nil, fmt.Errorf("publish_at is required for scheduled posts")
+	}
+	if !publishAt.After(time.Now()) {
+		return nil, fmt.Errorf("publish_at must be in the future")
+	}
+
+	formatted := publishAt.Format(time.RFC3339)
+	return &formatted, nil
 }
 
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
@@ -171,6 +506,19 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 
 			return
 		}
+
+		// Posts the caller may not see are reported as missing so that their
+		// existence is not leaked.
+		visible, err := app.canViewPost(ctx, getAuthUserFromCtx(r), post)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !visible {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postContextKey, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -180,3 +528,27 @@ func getPostFromCtx(r *http.Request) *store.Post {
 	post, _ := r.Context().Value(postContextKey).(*store.Post)
 	return post
 }
+
+// canViewPost reports whether viewer, nil when anonymous, may see post. It
+// mirrors the visibility rules the store applies to listings.
+func (app *application) canViewPost(ctx context.Context, viewer *store.User, post *store.Post) (bool, error) {
+	if viewer != nil && viewer.ID == post.UserID {
+		return true, nil
+	}
+	if post.Visibility == store.VisibilityOnlyMe || post.Status != store.StatusPublished {
+		return false, nil
+	}
+
+	author, err := app.store.Users.GetById(ctx, post.UserID)
+	if err != nil {
+		return false, err
+	}
+	if post.Visibility == store.VisibilityPublic && !author.IsPrivate {
+		return true, nil
+	}
+	if viewer == nil {
+		return false, nil
+	}
+
+	return app.store.Followers.IsFollowing(ctx, viewer.ID, post.UserID)
+}
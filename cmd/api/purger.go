@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runPurger permanently removes posts and comments whose soft delete is older
+// than the retention period, and users whose invitations expired before they
+// activated, checking every purge interval until ctx is cancelled. Like the post scheduler it is safe to run in every replica.
+func (app *application) runPurger(ctx context.Context) {
+	ticker := time.NewTicker(app.config.softDelete.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.purgeDeleted(ctx)
+		}
+	}
+}
+
+func (app *application) purgeDeleted(ctx context.Context) {
+	retention, batchSize := app.config.softDelete.retention, app.config.softDelete.batchSize
+
+	for _, purger := range []struct {
+		name  string
+		purge func(context.Context, time.Duration, int) (int64, error)
+	}{
+		{"posts", app.store.Posts.PurgeDeleted},
+		{"comments", app.store.Comments.PurgeDeleted},
+		{"unactivated users", func(ctx context.Context, _ time.Duration, limit int) (int64, error) {
+			return app.store.Users.PurgeUnactivated(ctx, limit)
+		}},
+	} {
+		for {
+			n, err := purger.purge(ctx, retention, batchSize)
+			if err != nil {
+				log.Printf("purger-error %s: %s", purger.name, err)
+				break
+			}
+			if n > 0 {
+				log.Printf("purger removed %d %s", n, purger.name)
+			}
+			// A full batch means more rows may have expired.
+			if n < int64(batchSize) {
+				break
+			}
+		}
+	}
+}
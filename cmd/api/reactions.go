@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/karthik446/social/internal/store"
+)
+
+type ReactionPayload struct {
+	Type string `json:"type" validate:"required,oneof=like love laugh"`
+}
+
+func (app *application) putReactionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getAuthUserFromCtx(r)
+
+	var payload ReactionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.store.Reactions.Set(ctx, post.ID, user.ID, payload.Type); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	summaries, err := app.store.Reactions.GetSummaries(ctx, []int64{post.ID}, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, summaries[post.ID]); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteReactionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getAuthUserFromCtx(r)
+
+	if err := app.store.Reactions.Remove(r.Context(), post.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// attachReactions fills in the reaction summary of every post in feed, as
+// seen by the user with id userID (0 when anonymous).
+func (app *application) attachReactions(ctx context.Context, feed []store.Feed, userID int64) error {
+	if len(feed) == 0 {
+		return nil
+	}
+
+	postIDs := make([]int64, len(feed))
+	for i, f := range feed {
+		postIDs[i] = f.ID
+	}
+
+	summaries, err := app.store.Reactions.GetSummaries(ctx, postIDs, userID)
+	if err != nil {
+		return err
+	}
+	for i := range feed {
+		feed[i].Reactions = summaries[feed[i].ID]
+	}
+	return nil
+}
+
+// attachPostReactions fills in the reaction summary of a single post.
+func (app *application) attachPostReactions(ctx context.Context, post *store.Post, userID int64) error {
+	summaries, err := app.store.Reactions.GetSummaries(ctx, []int64{post.ID}, userID)
+	if err != nil {
+		return err
+	}
+	post.Reactions = summaries[post.ID]
+	return nil
+}
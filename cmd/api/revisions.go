@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/karthik446/social/internal/diff"
+	"github.com/karthik446/social/internal/store"
+)
+
+// PostDiff describes what changed between two versions of a post.
+type PostDiff struct {
+	From        int         `json:"from"`
+	To          int         `json:"to"`
+	Title       []diff.Line `json:"title"`
+	Content     []diff.Line `json:"content"`
+	TagsAdded   []string    `json:"tags_added"`
+	TagsRemoved []string    `json:"tags_removed"`
+}
+
+func (app *application) listPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	revisions, err := app.store.PostRevisions.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getPostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	revision, err := app.store.PostRevisions.GetByVersion(r.Context(), post.ID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revision); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// diffPostRevisionsHandler compares the versions given by the from and to
+// query parameters. to defaults to the current version.
+func (app *application) diffPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	qs := r.URL.Query()
+	from, err := strconv.Atoi(qs.Get("from"))
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("invalid from version: %w", err))
+		return
+	}
+	to := post.Version
+	if v := qs.Get("to"); v != "" {
+		to, err = strconv.Atoi(v)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid to version: %w", err))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	revisions := make([]*store.PostRevision, 0, 2)
+	for _, version := range []int{from, to} {
+		revision, err := app.store.PostRevisions.GetByVersion(ctx, post.ID, version)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		revisions = append(revisions, revision)
+	}
+	old, cur := revisions[0], revisions[1]
+
+	postDiff := PostDiff{
+		From:        from,
+		To:          to,
+		Title:       diff.Lines(old.Title, cur.Title),
+		Content:     diff.Lines(old.Content, cur.Content),
+		TagsAdded:   make([]string, 0),
+		TagsRemoved: make([]string, 0),
+	}
+	for _, tag := range cur.Tags {
+		if !slices.Contains(old.Tags, tag) {
+			postDiff.TagsAdded = append(postDiff.TagsAdded, tag)
+		}
+	}
+	for _, tag := range old.Tags {
+		if !slices.Contains(cur.Tags, tag) {
+			postDiff.TagsRemoved = append(postDiff.TagsRemoved, tag)
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, postDiff); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// revertPostHandler restores an earlier version of the post as a new
+// version. Only the author may do so, whatever the caller's role.
+func (app *application) revertPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getAuthUserFromCtx(r)
+
+	if post.UserID != user.ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if version >= post.Version {
+		app.badRequestResponse(w, r, fmt.Errorf("version %d is not an earlier version of the post", version))
+		return
+	}
+
+	if err := app.store.Posts.Revert(r.Context(), post, version); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.attachPostReactions(r.Context(), post, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", postETag(post))
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
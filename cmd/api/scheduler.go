@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runPostScheduler publishes scheduled posts once their publish time has
+// passed, checking every scheduler interval until ctx is cancelled. It is
+// safe to run in every API replica: the store claims due posts with row
+// locks, so each one is published by exactly one of them.
+func (app *application) runPostScheduler(ctx context.Context) {
+	ticker := time.NewTicker(app.config.scheduler.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.publishDuePosts(ctx)
+		}
+	}
+}
+
+func (app *application) publishDuePosts(ctx context.Context) {
+	for {
+		ids, err := app.store.Posts.PublishDue(ctx, app.config.scheduler.batchSize)
+		if err != nil {
+			log.Printf("post-scheduler-error %s", err)
+			return
+		}
+
+		for _, id := range ids {
+			app.enqueueTimelineJob(timelineJob{kind: timelineFanOutPost, postID: id})
+		}
+		if len(ids) > 0 {
+			log.Printf("post-scheduler published %d posts", len(ids))
+		}
+
+		// A full batch means more posts may be due.
+		if len(ids) < app.config.scheduler.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/karthik446/social/internal/store"
+)
+
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	sq := store.SearchQuery{
+		Type:  store.SearchPosts,
+		Limit: 20,
+	}
+	sq, err := sq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := validate.Struct(sq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	results, err := app.store.Search.Search(r.Context(), getAuthUserIDFromCtx(r), sq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/karthik446/social/internal/store"
+)
+
+// tagParam returns the normalized tag in the URL.
+func tagParam(r *http.Request) (string, error) {
+	tag := store.NormalizeTag(chi.URLParam(r, "tag"))
+	switch {
+	case tag == "":
+		return "", errors.New("tag must not be empty")
+	case utf8.RuneCountInString(tag) > store.MaxTagLength:
+		return "", fmt.Errorf("tag must be at most %d characters long", store.MaxTagLength)
+	}
+	return tag, nil
+}
+
+// listTagPostsHandler lists the posts carrying the tag in the URL, with the
+// same filters and pagination as the posts listing.
+func (app *application) listTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := tagParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	lq, err := defaultPostsListQuery().Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	lq.Tags = []string{tag}
+
+	app.writePostsList(w, r, lq)
+}
+
+// followTagHandler adds posts carrying the tag to the caller's feed, even
+// from authors the caller does not follow.
+func (app *application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	tag, err := tagParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Tags.Follow(r.Context(), user.ID, tag); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	tag, err := tagParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Tags.Unfollow(r.Context(), user.ID, tag); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) listTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := app.store.Tags.GetTrending(r.Context(), app.config.trending.limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// runTrendingRefresher recomputes the trending tags right away and then every
+// refresh interval until ctx is cancelled, so requests only ever read the
+// precomputed result.
+func (app *application) runTrendingRefresher(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trending.interval)
+	defer ticker.Stop()
+
+	for {
+		cfg := app.config.trending
+		if err := app.store.Tags.RefreshTrending(ctx, cfg.recentWindow, cfg.baselineWindow, cfg.minCount, cfg.limit); err != nil {
+			log.Printf("trending-refresher-error %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
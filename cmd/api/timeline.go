@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// timelineBackfillLimit is how many of an author's recent posts are copied
+// into a follower's timeline when they start following.
+const timelineBackfillLimit = 100
+
+type timelineJobKind int
+
+const (
+	timelineFanOutPost timelineJobKind = iota
+	timelineBackfill
+	timelineRemoveAuthor
+)
+
+type timelineJob struct {
+	kind     timelineJobKind
+	postID   int64
+	userID   int64
+	authorID int64
+}
+
+// enqueueTimelineJob hands a job to the timeline worker. When the queue is
+// full the job runs on the caller's goroutine so that no update is dropped.
+func (app *application) enqueueTimelineJob(job timelineJob) {
+	select {
+	case app.timelineJobs <- job:
+	default:
+		app.processTimelineJob(job)
+	}
+}
+
+// runTimelineWorker keeps the materialized timelines in sync with new posts
+// and follow changes until ctx is cancelled.
+func (app *application) runTimelineWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-app.timelineJobs:
+			app.processTimelineJob(job)
+		}
+	}
+}
+
+func (app *application) processTimelineJob(job timelineJob) {
+	ctx := context.Background()
+
+	var err error
+	switch job.kind {
+	case timelineFanOutPost:
+		err = app.store.Timelines.FanOutPost(ctx, job.postID)
+	case timelineBackfill:
+		err = app.store.Timelines.Backfill(ctx, job.userID, job.authorID, timelineBackfillLimit)
+	case timelineRemoveAuthor:
+		err = app.store.Timelines.RemoveAuthor(ctx, job.userID, job.authorID)
+	}
+	if err != nil {
+		log.Printf("timeline-job-error kind: %d, post: %d, user: %d, author: %d, %s", job.kind, job.postID, job.userID, job.authorID, err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,38 +12,81 @@ import (
 
 const userContextKey contextKey = "user"
 
+type UserProfile struct {
+	*store.User
+	store.UserStats
+	IsFollowedByMe *bool `json:"is_followed_by_me,omitempty"`
+}
+
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromCtx(r)
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+
+	ctx := r.Context()
+	stats, err := app.store.Users.GetStats(ctx, user.ID)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-}
 
-type FollowUserPayload struct {
-	UserID int64 `json:"user_id"`
+	profile := UserProfile{User: user, UserStats: *stats}
+	if authUser := getAuthUserFromCtx(r); authUser != nil {
+		following, err := app.store.Followers.IsFollowing(ctx, authUser.ID, user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		profile.IsFollowedByMe = &following
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 }
 
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
-	followerUser := getUserFromCtx(r)
+	followerUser := getAuthUserFromCtx(r)
+	followedUser := getUserFromCtx(r)
 
-	var payload FollowUserPayload
-	if err := readJSON(w, r, &payload); err != nil {
-		app.badRequestResponse(w, r, err)
+	if followerUser.ID == followedUser.ID {
+		app.badRequestResponse(w, r, errors.New("you cannot follow yourself"))
 		return
 	}
 
 	ctx := r.Context()
-	if err := app.store.Followers.Follow(ctx, followerUser.ID, payload.UserID); err != nil {
+	if followedUser.IsPrivate {
+		if err := app.store.FollowRequests.Create(ctx, followerUser.ID, followedUser.ID); err != nil {
+			switch {
+			case errors.Is(err, store.ErrDuplicateKeyConflict):
+				app.duplicateKeyConflict(w, r, err)
+			case errors.Is(err, store.ErrBlocked):
+				app.forbiddenResponse(w, r)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if err := app.jsonResponse(w, http.StatusAccepted, map[string]string{"status": "requested"}); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Followers.Follow(ctx, followerUser.ID, followedUser.ID); err != nil {
 		switch err {
 		case store.ErrDuplicateKeyConflict:
 			app.duplicateKeyConflict(w, r, err)
 			return
+		case store.ErrBlocked:
+			app.forbiddenResponse(w, r)
+			return
 		default:
 			app.internalServerError(w, r, err)
 			return
 		}
 	}
+	app.enqueueTimelineJob(timelineJob{kind: timelineBackfill, userID: followerUser.ID, authorID: followedUser.ID})
 
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
@@ -51,18 +95,15 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	followerUser := getAuthUserFromCtx(r)
 	unfollowedUser := getUserFromCtx(r)
 
-	var payload FollowUserPayload
-	if err := readJSON(w, r, &payload); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
 	ctx := r.Context()
-	if err := app.store.Followers.UnFollow(ctx, unfollowedUser.ID, payload.UserID); err != nil {
+	if err := app.store.Followers.UnFollow(ctx, followerUser.ID, unfollowedUser.ID); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.enqueueTimelineJob(timelineJob{kind: timelineRemoveAuthor, userID: followerUser.ID, authorID: unfollowedUser.ID})
 
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
@@ -101,3 +142,165 @@ func getUserFromCtx(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userContextKey).(*store.User)
 	return user
 }
+
+func (app *application) listFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.GetFollowers)
+}
+
+func (app *application) listFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.GetFollowing)
+}
+
+func (app *application) listFollows(w http.ResponseWriter, r *http.Request, list func(context.Context, int64, store.FollowQuery) ([]store.FollowUser, error)) {
+	user := getUserFromCtx(r)
+
+	fq := store.FollowQuery{
+		Limit: 20,
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, err := list(r.Context(), user.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, users, store.FollowCursors(fq, users)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type UpdateMePayload struct {
+	IsPrivate *bool `json:"is_private"`
+}
+
+func (app *application) updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	var payload UpdateMePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	wasPrivate := user.IsPrivate
+	if payload.IsPrivate != nil {
+		user.IsPrivate = *payload.IsPrivate
+	}
+
+	if err := app.store.Users.Update(ctx, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Going public lets everyone who was waiting in.
+	if wasPrivate && !user.IsPrivate {
+		followerIDs, err := app.store.FollowRequests.AcceptAll(ctx, user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		for _, id := range followerIDs {
+			app.enqueueTimelineJob(timelineJob{kind: timelineBackfill, userID: id, authorID: user.ID})
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) listFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	requests, err := app.store.FollowRequests.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, requests); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) acceptFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "requesterId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.FollowRequests.Accept(r.Context(), user.ID, requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.enqueueTimelineJob(timelineJob{kind: timelineBackfill, userID: requesterID, authorID: user.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "requesterId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.FollowRequests.Reject(r.Context(), user.ID, requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireSelf answers 403 unless the user in the URL is the caller.
+func (app *application) requireSelf(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	user := getUserFromCtx(r)
+	if authUser := getAuthUserFromCtx(r); authUser == nil || authUser.ID != user.ID {
+		app.forbiddenResponse(w, r)
+		return nil, false
+	}
+	return user, true
+}
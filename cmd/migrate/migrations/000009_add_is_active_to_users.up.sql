@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET is_active = TRUE;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS user_invitations (
+    token bytea PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    expiry TIMESTAMP(0) with time zone NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
\ No newline at end of file
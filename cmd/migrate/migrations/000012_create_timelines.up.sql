@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS timelines (
+    user_id BIGINT NOT NULL,
+    post_id BIGINT NOT NULL,
+    created_at TIMESTAMP(0) with time zone NOT NULL,
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_timelines_user_id_created_at ON timelines (user_id, created_at DESC, post_id DESC);
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
+
+INSERT INTO timelines (user_id, post_id, created_at)
+SELECT f.follower_id, p.id, p.created_at FROM followers f JOIN posts p ON p.user_id = f.user_id
+UNION
+SELECT p.user_id, p.id, p.created_at FROM posts p
+ON CONFLICT DO NOTHING;
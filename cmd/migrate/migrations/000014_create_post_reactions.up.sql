@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS post_reactions (
+    user_id BIGINT NOT NULL,
+    post_id BIGINT NOT NULL,
+    reaction VARCHAR(20) NOT NULL CHECK (reaction IN ('like', 'love', 'laugh')),
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_reactions_post_id ON post_reactions (post_id);
@@ -0,0 +1,2 @@
+ALTER TABLE posts ADD COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'followers', 'only_me'));
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE posts ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'published'
+    CHECK (status IN ('draft', 'scheduled', 'published'));
+
+ALTER TABLE posts ADD COLUMN publish_at TIMESTAMP(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled_publish_at ON posts (publish_at) WHERE status = 'scheduled';
@@ -0,0 +1,5 @@
+ALTER TABLE posts ADD COLUMN deleted_at TIMESTAMP(0) with time zone;
+ALTER TABLE comments ADD COLUMN deleted_at TIMESTAMP(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE posts DROP COLUMN IF EXISTS quoted_post_id;
+
+DROP TABLE IF EXISTS reposts;
\ No newline at end of file
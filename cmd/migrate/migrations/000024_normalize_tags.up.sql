@@ -0,0 +1,14 @@
+UPDATE posts SET tags = (
+    SELECT coalesce(array_agg(DISTINCT t), '{}')
+    FROM (SELECT lower(ltrim(btrim(tag), '#')) AS t FROM unnest(posts.tags) AS tag) normalized
+    WHERE t <> ''
+)
+WHERE tags IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS trending_tags (
+    tag VARCHAR(255) PRIMARY KEY,
+    recent_count INT NOT NULL,
+    baseline_count INT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    refreshed_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW()
+);
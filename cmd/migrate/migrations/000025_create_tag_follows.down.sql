@@ -0,0 +1 @@
+DROP TABLE IF EXISTS tag_follows;
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- Generated columns need an immutable expression. array_to_string is only
+-- declared stable, but it is immutable for arrays of text.
+CREATE OR REPLACE FUNCTION posts_search_vector(title TEXT, content TEXT, tags VARCHAR[]) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+           setweight(to_tsvector('simple', coalesce(array_to_string(tags, ' '), '')), 'B') ||
+           setweight(to_tsvector('english', coalesce(content, '')), 'C')
+$$ LANGUAGE SQL IMMUTABLE;
+
+ALTER TABLE posts ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (posts_search_vector(title, content, tags)) STORED;
+
+ALTER TABLE comments ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING GIN (username gin_trgm_ops);
@@ -0,0 +1,2 @@
+ALTER TABLE post_revisions DROP COLUMN IF EXISTS explicit_tags;
+ALTER TABLE posts DROP COLUMN IF EXISTS explicit_tags;
@@ -0,0 +1,23 @@
+-- tags holds the tags a post was given plus the hashtags in its content.
+-- explicit_tags keeps the former apart, so the tags of an edited post can be
+-- recomputed and hashtags removed from the content drop out again.
+ALTER TABLE posts ADD COLUMN explicit_tags VARCHAR(255) [];
+ALTER TABLE post_revisions ADD COLUMN explicit_tags VARCHAR(255) [];
+
+-- Existing posts only kept the merged tags, so any tag that also appears as a
+-- hashtag in the content is taken to have come from it.
+UPDATE posts SET explicit_tags = ARRAY(
+    SELECT tag FROM unnest(posts.tags) AS tag
+    WHERE tag NOT IN (
+        SELECT lower(m[1]) FROM regexp_matches(posts.content, '(?:^|[^A-Za-z0-9_#&/])#([A-Za-z0-9_]+)', 'g') AS m
+    )
+)
+WHERE tags IS NOT NULL;
+
+UPDATE post_revisions SET explicit_tags = ARRAY(
+    SELECT tag FROM unnest(post_revisions.tags) AS tag
+    WHERE tag NOT IN (
+        SELECT lower(m[1]) FROM regexp_matches(post_revisions.content, '(?:^|[^A-Za-z0-9_#&/])#([A-Za-z0-9_]+)', 'g') AS m
+    )
+)
+WHERE tags IS NOT NULL;
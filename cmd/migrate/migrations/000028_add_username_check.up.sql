@@ -0,0 +1,4 @@
+-- Usernames are limited to what a mention can match. NOT VALID leaves
+-- existing rows alone while every new or renamed user is checked.
+ALTER TABLE users ADD CONSTRAINT users_username_format
+    CHECK (username ~ '^[A-Za-z0-9_]{1,100}$') NOT VALID;
@@ -232,6 +232,12 @@ func Seed(store store.Storage) {
 			log.Println("Error creating post:", err)
 			return
 		}
+		// Feeds are read from timelines, which migrations only backfilled
+		// for posts that existed before seeding.
+		if err := store.Timelines.FanOutPost(ctx, p.ID); err != nil {
+			log.Println("Error fanning out post:", err)
+			return
+		}
 	}
 
 	comments := generateComments(100, users, posts)
@@ -252,7 +258,10 @@ func generateUsers(n int) []*store.User {
 		users[i] = &store.User{
 			Username: u + strconv.Itoa(i),
 			Email:    u + strconv.Itoa(i) + "@example.com",
-			Password: "password",
+			IsActive: true,
+		}
+		if err := users[i].Password.Set("password"); err != nil {
+			log.Fatalf("error hashing password: %v", err)
 		}
 	}
 	return users
@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// LocalMailer renders emails and writes them to a directory, one file per
+// message, or to stdout when no directory is configured. It lets the API run
+// without an SMTP server.
+type LocalMailer struct {
+	fromEmail string
+	dir       string
+	mu        sync.Mutex
+}
+
+func NewLocalMailer(fromEmail, dir string) (*LocalMailer, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &LocalMailer{fromEmail: fromEmail, dir: dir}, nil
+}
+
+func (m *LocalMailer) Send(templateFile, username, email string, data any) error {
+	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return err
+	}
+	body := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(body, "body", data); err != nil {
+		return err
+	}
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s <%s>\r\n", FromName, m.fromEmail)
+	fmt.Fprintf(msg, "To: %s <%s>\r\n", username, email)
+	fmt.Fprintf(msg, "Subject: %s\r\n", subject.String())
+	fmt.Fprintf(msg, "Date: %s\r\n\r\n", time.Now().Format(time.RFC1123Z))
+	msg.Write(body.Bytes())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.dir == "" {
+		_, err := io.Copy(os.Stdout, msg)
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), email)
+	return os.WriteFile(filepath.Join(m.dir, name), msg.Bytes(), 0o644)
+}
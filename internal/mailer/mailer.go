@@ -0,0 +1,17 @@
+package mailer
+
+import "embed"
+
+const (
+	FromName           = "Social"
+	UserInvitationTmpl = "user_invitation.tmpl"
+)
+
+//go:embed templates
+var FS embed.FS
+
+// Client sends a templated email. The template must define a "subject" and a
+// "body" block.
+type Client interface {
+	Send(templateFile, username, email string, data any) error
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type BlocksStore struct {
+	db *sql.DB
+}
+
+// Block blocks BlockedID for BlockerID and severs every follow and pending
+// follow request between the two, in both directions.
+func (s *BlocksStore) Block(ctx context.Context, BlockerID int64, BlockedID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		query := `INSERT INTO blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		if _, err := tx.ExecContext(ctx, query, BlockerID, BlockedID); err != nil {
+			return err
+		}
+
+		query = `DELETE FROM followers
+		WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)`
+		if _, err := tx.ExecContext(ctx, query, BlockerID, BlockedID); err != nil {
+			return err
+		}
+
+		query = `DELETE FROM follow_requests
+		WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)`
+		_, err := tx.ExecContext(ctx, query, BlockerID, BlockedID)
+		return err
+	})
+}
+
+func (s *BlocksStore) Unblock(ctx context.Context, BlockerID int64, BlockedID int64) error {
+	query := `DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, BlockerID, BlockedID)
+	return err
+}
+
+type MutesStore struct {
+	db *sql.DB
+}
+
+func (s *MutesStore) Mute(ctx context.Context, MuterID int64, MutedID int64) error {
+	query := `INSERT INTO mutes (muter_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, MuterID, MutedID)
+	return err
+}
+
+func (s *MutesStore) Unmute(ctx context.Context, MuterID int64, MutedID int64) error {
+	query := `DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, MuterID, MutedID)
+	return err
+}
+
+// checkNotBlocked returns ErrBlocked if either user blocked the other.
+func checkNotBlocked(ctx context.Context, db *sql.DB, a, b int64) error {
+	query := `SELECT ` + notBlockedBetween("$1::bigint", "$2::bigint")
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	var ok bool
+	if err := db.QueryRowContext(ctx, query, a, b).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// notBlockedBetween is a SQL condition that holds unless the two users, given
+// as SQL expressions, have blocked one another in either direction.
+func notBlockedBetween(a, b string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM blocks bl
+		WHERE (bl.blocker_id = %[1]s AND bl.blocked_id = %[2]s) OR (bl.blocker_id = %[2]s AND bl.blocked_id = %[1]s))`, a, b)
+}
+
+// notHiddenFrom is a SQL condition that holds unless viewer muted author or
+// the two are blocked in either direction.
+func notHiddenFrom(author, viewer string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM mutes mu WHERE mu.muter_id = %[2]s AND mu.muted_id = %[1]s) AND %[3]s`,
+		author, viewer, notBlockedBetween(author, viewer))
+}
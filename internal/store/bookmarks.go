@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// BookmarkCollection is a named folder a user files bookmarks under.
+type BookmarkCollection struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+type BookmarksStore struct {
+	db *sql.DB
+}
+
+// Set bookmarks the post for the user, or moves an existing bookmark to
+// collectionID. A nil collectionID leaves the bookmark outside any
+// collection. ErrNotFound is returned when the collection is not the user's.
+func (s *BookmarksStore) Set(ctx context.Context, userID, postID int64, collectionID *int64) error {
+	query := `INSERT INTO bookmarks (user_id, post_id, collection_id)
+	SELECT $1, $2, $3
+	WHERE $3::bigint IS NULL OR EXISTS (SELECT 1 FROM bookmark_collections WHERE id = $3 AND user_id = $1)
+	ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, userID, postID, collectionID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *BookmarksStore) Remove(ctx context.Context, userID, postID int64) error {
+	query := `DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetByUserID returns the user's bookmarked posts, most recently bookmarked
+// first. Posts the user can no longer see are left out.
+func (s *BookmarksStore) GetByUserID(ctx context.Context, userID int64, bq BookmarkQuery) ([]Feed, error) {
+	query := `SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.visibility, u.username,
+		(SELECT count(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) AS comments_count,
+		b.collection_id, b.created_at
+	FROM bookmarks b
+	JOIN posts p ON p.id = b.post_id
+	JOIN users u ON u.id = p.user_id
+	WHERE b.user_id = $1 AND
+		($2::bigint IS NULL OR b.collection_id = $2) AND
+		($3::timestamptz IS NULL OR (b.created_at, b.post_id) < ($3::timestamptz, $4::bigint)) AND
+		p.status = 'published' AND p.deleted_at IS NULL AND
+		` + postVisibleTo("$1::bigint") + ` AND
+		` + notHiddenFrom("p.user_id", "$1::bigint") + `
+	ORDER BY b.created_at DESC, b.post_id DESC
+	LIMIT $5`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := bq.keysetArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, bq.CollectionID, cursorCreatedAt, cursorID, bq.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feed := make([]Feed, 0)
+	for rows.Next() {
+		var f Feed
+		if err := rows.Scan(&f.ID, &f.UserID, &f.Title, &f.Content, &f.CreatedAt, &f.Version, pq.Array(&f.Tags), &f.Visibility, &f.User.Username, &f.CommentsCount, &f.CollectionID, &f.BookmarkedAt); err != nil {
+			return nil, err
+		}
+		f.User.ID = f.UserID
+		feed = append(feed, f)
+	}
+	return feed, rows.Err()
+}
+
+type BookmarkCollectionsStore struct {
+	db *sql.DB
+}
+
+func (s *BookmarkCollectionsStore) Create(ctx context.Context, c *BookmarkCollection) error {
+	query := `INSERT INTO bookmark_collections (user_id, name) VALUES ($1, $2) RETURNING id, created_at`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, query, c.UserID, c.Name).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrDuplicateKeyConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *BookmarkCollectionsStore) GetByUserID(ctx context.Context, userID int64) ([]BookmarkCollection, error) {
+	query := `SELECT id, user_id, name, created_at FROM bookmark_collections WHERE user_id = $1 ORDER BY name`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := make([]BookmarkCollection, 0)
+	for rows.Next() {
+		var c BookmarkCollection
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// Delete removes one of the user's collections. The bookmarks filed under it
+// are kept, outside any collection.
+func (s *BookmarkCollectionsStore) Delete(ctx context.Context, userID, collectionID int64) error {
+	query := `DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, collectionID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -3,90 +3,230 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"time"
 )
 
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID         int64     `json:"id"`
+	PostID     int64     `json:"post_id"`
+	ParentID   *int64    `json:"parent_id"`
+	UserID     int64     `json:"user_id"`
+	Content    string    `json:"content"`
+	CreatedAt  string    `json:"created_at"`
+	User       User      `json:"user"`
+	ReplyCount int       `json:"reply_count"`
+	Replies    []Comment `json:"replies,omitempty"`
+	Mentions   []Mention `json:"mentions"`
 }
 
 type CommentsStore struct {
 	db *sql.DB
 }
 
-func (s *CommentsStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
-	query := `SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.username, u.id FROM comments c
-    JOIN users u ON c.user_id = u.id
-    WHERE c.post_id = $1
-    ORDER BY c.created_at DESC`
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
-	defer cancel()
-	rows, err := s.db.QueryContext(ctx, query, postID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	comments := []Comment{}
-	for rows.Next() {
-		var c Comment
-		c.User = User{}
-		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID); err != nil {
-			return nil, err
-		}
-		comments = append(comments, c)
-	}
-	return comments, nil
-}
-
 func (s *CommentsStore) GetById(ctx context.Context, commentID int64) (*Comment, error) {
-	query := `SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.username, u.id FROM comments c
+	query := `SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, c.created_at, u.username, u.id,
+	(SELECT count(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL) AS reply_count
+	FROM comments c
 	JOIN users u ON c.user_id = u.id
-	WHERE c.id = $1`
+	WHERE c.id = $1 AND c.deleted_at IS NULL`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 	var c Comment
 	c.User = User{}
-	err := s.db.QueryRowContext(ctx, query, commentID).Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(&c.ID, &c.PostID, &c.ParentID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID, &c.ReplyCount)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
 	}
 	return &c, nil
 }
 
 func (s *CommentsStore) Create(ctx context.Context, c *Comment) error {
-	query := `INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3) RETURNING id, created_at`
+	// Nothing is inserted when the commenter and the author of the post, or
+	// of the comment replied to, have blocked one another.
+	query := `INSERT INTO comments (post_id, parent_id, user_id, content)
+	SELECT $1, $2, $3, $4
+	WHERE ` + notBlockedBetween("$3::bigint", "(SELECT user_id FROM posts WHERE id = $1)") + ` AND
+		($2::bigint IS NULL OR ` + notBlockedBetween("$3::bigint", "(SELECT user_id FROM comments WHERE id = $2)") + `)
+	RETURNING id, created_at`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, c.PostID, c.UserID, c.Content).Scan(&c.ID, &c.CreatedAt)
-	if err != nil {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, c.PostID, c.ParentID, c.UserID, c.Content).Scan(&c.ID, &c.CreatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrBlocked
+			default:
+				return err
+			}
+		}
+
+		c.Mentions, err = saveMentions(ctx, tx, "comment_id", c.ID, c.UserID, c.Content)
 		return err
-	}
-	return nil
+	})
 }
 
 func (s *CommentsStore) DeleteById(ctx context.Context, commentID int64) error {
-	query := `DELETE FROM comments WHERE id = $1`
+	query := `UPDATE comments SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, query, commentID)
+	res, err := s.db.ExecContext(ctx, query, commentID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
 func (s *CommentsStore) Update(ctx context.Context, c *Comment) error {
-	query := `UPDATE comments SET content = $1 WHERE id = $2`
+	query := `UPDATE comments SET content = $1 WHERE id = $2 AND deleted_at IS NULL`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, query, c.Content, c.ID)
-	if err != nil {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, c.Content, c.ID)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		c.Mentions, err = saveMentions(ctx, tx, "comment_id", c.ID, c.UserID, c.Content)
 		return err
+	})
+}
+
+// GetByPostID returns a page of a post's comments as a tree. The root level
+// holds the replies to ct.ParentID, or the top-level comments when it is nil,
+// sorted by ct.Sort and paginated by ct.Limit and either ct.Offset or the
+// cursor. Below it, at most ct.Limit replies per comment are loaded, oldest
+// first, down to ct.Depth levels. ReplyCount tells clients where more
+// replies can be fetched.
+//
+// Comments by authors viewerID muted or is blocked with are left out, along
+// with their replies; pass 0 for anonymous callers.
+func (s *CommentsStore) GetByPostID(ctx context.Context, postID int64, viewerID int64, ct CommentTreeQuery) ([]Comment, error) {
+	op, order := ct.keyset()
+	query := `WITH RECURSIVE roots AS (
+		SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, c.created_at,
+			row_number() OVER (ORDER BY c.created_at ` + order + `, c.id ` + order + `) AS position
+		FROM comments c
+		WHERE c.post_id = $1 AND c.parent_id IS NOT DISTINCT FROM $2::bigint AND c.deleted_at IS NULL AND
+			($6::timestamptz IS NULL OR (c.created_at, c.id) ` + op + ` ($6::timestamptz, $7::bigint)) AND
+			` + notHiddenFrom("c.user_id", "$8::bigint") + `
+		ORDER BY c.created_at ` + order + `, c.id ` + order + `
+		LIMIT $3 OFFSET $4
+	),
+	replies AS (
+		SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, c.created_at,
+			row_number() OVER (PARTITION BY c.parent_id ORDER BY c.created_at ASC, c.id ASC) AS position
+		FROM comments c
+		WHERE c.post_id = $1 AND c.parent_id IS NOT NULL AND c.deleted_at IS NULL AND
+			` + notHiddenFrom("c.user_id", "$8::bigint") + `
+	),
+	tree AS (
+		SELECT r.id, r.post_id, r.parent_id, r.user_id, r.content, r.created_at, r.position, 1 AS depth
+		FROM roots r
+		UNION ALL
+		SELECT r.id, r.post_id, r.parent_id, r.user_id, r.content, r.created_at, r.position, t.depth + 1
+		FROM replies r
+		JOIN tree t ON r.parent_id = t.id
+		WHERE t.depth < $5 AND r.position <= $3
+	)
+	SELECT t.id, t.post_id, t.parent_id, t.user_id, t.content, t.created_at, u.username, u.id,
+		(SELECT count(*) FROM comments r WHERE r.parent_id = t.id AND r.deleted_at IS NULL) AS reply_count
+	FROM tree t
+	JOIN users u ON t.user_id = u.id
+	ORDER BY t.depth, t.parent_id, t.position`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	cursorCreatedAt, cursorID := ct.keysetArgs()
+	rows, err := s.db.QueryContext(ctx, query, postID, ct.ParentID, ct.Limit, ct.offset(), ct.Depth, cursorCreatedAt, cursorID, viewerID)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	var nodes []*Comment
+	for rows.Next() {
+		c := &Comment{}
+		if err := rows.Scan(&c.ID, &c.PostID, &c.ParentID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID, &c.ReplyCount); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildCommentTree(nodes, ct.ParentID), nil
+}
+
+func (s *CommentsStore) CountByPostID(ctx context.Context, postID int64) (int, error) {
+	query := `SELECT count(*) FROM comments WHERE post_id = $1 AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	var count int
+	if err := s.db.QueryRowContext(ctx, query, postID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// buildCommentTree nests nodes under their parents. nodes must be ordered so
+// that every parent comes before its replies.
+func buildCommentTree(nodes []*Comment, rootParentID *int64) []Comment {
+	children := make(map[int64][]*Comment)
+	roots := make([]*Comment, 0)
+	for _, n := range nodes {
+		if n.ParentID == nil || (rootParentID != nil && *n.ParentID == *rootParentID) {
+			roots = append(roots, n)
+			continue
+		}
+		children[*n.ParentID] = append(children[*n.ParentID], n)
+	}
+
+	var attach func(ns []*Comment) []Comment
+	attach = func(ns []*Comment) []Comment {
+		out := make([]Comment, 0, len(ns))
+		for _, n := range ns {
+			if kids, ok := children[n.ID]; ok {
+				n.Replies = attach(kids)
+			}
+			out = append(out, *n)
+		}
+		return out
+	}
+	return attach(roots)
+}
+
+// PurgeDeleted permanently removes up to limit comments soft deleted more
+// than retention ago, along with their replies, and returns how many went.
+func (s *CommentsStore) PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int64, error) {
+	query := `DELETE FROM comments WHERE id IN (
+		SELECT id FROM comments WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2 FOR UPDATE SKIP LOCKED
+	)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, time.Now().Add(-retention), limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
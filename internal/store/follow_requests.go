@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// FollowRequest is a pending request to follow a private account.
+type FollowRequest struct {
+	UserID      int64  `json:"user_id"`
+	RequesterID int64  `json:"requester_id"`
+	CreatedAt   string `json:"created_at"`
+	Requester   User   `json:"requester"`
+}
+
+type FollowRequestsStore struct {
+	db *sql.DB
+}
+
+// Create asks to follow the private account UserID. It fails with
+// ErrDuplicateKeyConflict if the requester already follows it or has a
+// request pending, and with ErrBlocked if either blocked the other.
+func (s *FollowRequestsStore) Create(ctx context.Context, RequesterID int64, UserID int64) error {
+	if err := checkNotBlocked(ctx, s.db, RequesterID, UserID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO follow_requests (user_id, requester_id)
+	SELECT $1, $2
+	WHERE NOT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, UserID, RequesterID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrDuplicateKeyConflict
+		}
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrDuplicateKeyConflict
+	}
+	return nil
+}
+
+func (s *FollowRequestsStore) GetByUserID(ctx context.Context, userID int64) ([]FollowRequest, error) {
+	query := `SELECT fr.user_id, fr.requester_id, fr.created_at, u.id, u.username
+	FROM follow_requests fr
+	JOIN users u ON u.id = fr.requester_id
+	WHERE fr.user_id = $1
+	ORDER BY fr.created_at DESC`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]FollowRequest, 0)
+	for rows.Next() {
+		var fr FollowRequest
+		if err := rows.Scan(&fr.UserID, &fr.RequesterID, &fr.CreatedAt, &fr.Requester.ID, &fr.Requester.Username); err != nil {
+			return nil, err
+		}
+		requests = append(requests, fr)
+	}
+	return requests, rows.Err()
+}
+
+// Accept turns the pending request into a follow.
+func (s *FollowRequestsStore) Accept(ctx context.Context, UserID int64, RequesterID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.delete(ctx, tx, UserID, RequesterID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+		_, err := tx.ExecContext(ctx, query, UserID, RequesterID)
+		return err
+	})
+}
+
+func (s *FollowRequestsStore) Reject(ctx context.Context, UserID int64, RequesterID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.delete(ctx, tx, UserID, RequesterID)
+	})
+}
+
+// AcceptAll turns every pending request to UserID into a follow, for when the
+// account is made public, and returns the ids of the new followers.
+func (s *FollowRequestsStore) AcceptAll(ctx context.Context, UserID int64) ([]int64, error) {
+	query := `WITH accepted AS (
+		DELETE FROM follow_requests WHERE user_id = $1 RETURNING user_id, requester_id
+	)
+	INSERT INTO followers (user_id, follower_id)
+	SELECT user_id, requester_id FROM accepted
+	ON CONFLICT DO NOTHING
+	RETURNING follower_id`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *FollowRequestsStore) delete(ctx context.Context, tx *sql.Tx, UserID int64, RequesterID int64) error {
+	query := `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := tx.ExecContext(ctx, query, UserID, RequesterID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -13,26 +13,110 @@ type Follower struct {
 	CreatedAt  string `json:"created_at"`
 }
 
+// FollowUser is a user in a followers or following list, along with when
+// the follow happened.
+type FollowUser struct {
+	ID         int64  `json:"id"`
+	Username   string `json:"username"`
+	CreatedAt  string `json:"created_at"`
+	FollowedAt string `json:"followed_at"`
+}
+
 type FollowersStore struct {
 	db *sql.DB
 }
 
 func (s *FollowersStore) Follow(ctx context.Context, FollowerID int64, UserID int64) error {
-	query := `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`
-	_, err := s.db.ExecContext(ctx, query, UserID, FollowerID)
+	query := `INSERT INTO followers (user_id, follower_id)
+	SELECT $1, $2
+	WHERE ` + notBlockedBetween("$1::bigint", "$2::bigint")
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, UserID, FollowerID)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
 			return ErrDuplicateKeyConflict
 		}
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrBlocked
 	}
 	return nil
 }
 
+// UnFollow removes the follow, or withdraws the pending follow request to a
+// private account.
 func (s *FollowersStore) UnFollow(ctx context.Context, FollowerID int64, UserID int64) error {
-	query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
-	_, err := s.db.ExecContext(ctx, query, UserID, FollowerID)
-	if err != nil {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
+		if _, err := tx.ExecContext(ctx, query, UserID, FollowerID); err != nil {
+			return err
+		}
+
+		query = `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`
+		_, err := tx.ExecContext(ctx, query, UserID, FollowerID)
 		return err
+	})
+}
+
+// GetFollowers lists the users following userID.
+func (s *FollowersStore) GetFollowers(ctx context.Context, userID int64, fq FollowQuery) ([]FollowUser, error) {
+	query := `SELECT u.id, u.username, u.created_at, f.created_at
+	FROM followers f
+	JOIN users u ON u.id = f.follower_id
+	WHERE f.user_id = $1 AND
+		($3::timestamptz IS NULL OR (f.created_at, u.id) < ($3::timestamptz, $4::bigint))
+	ORDER BY f.created_at DESC, u.id DESC
+	LIMIT $2`
+	return s.list(ctx, query, userID, fq)
+}
+
+// GetFollowing lists the users userID follows.
+func (s *FollowersStore) GetFollowing(ctx context.Context, userID int64, fq FollowQuery) ([]FollowUser, error) {
+	query := `SELECT u.id, u.username, u.created_at, f.created_at
+	FROM followers f
+	JOIN users u ON u.id = f.user_id
+	WHERE f.follower_id = $1 AND
+		($3::timestamptz IS NULL OR (f.created_at, u.id) < ($3::timestamptz, $4::bigint))
+	ORDER BY f.created_at DESC, u.id DESC
+	LIMIT $2`
+	return s.list(ctx, query, userID, fq)
+}
+
+func (s *FollowersStore) list(ctx context.Context, query string, userID int64, fq FollowQuery) ([]FollowUser, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := fq.keysetArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, cursorCreatedAt, cursorID)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	users := make([]FollowUser, 0)
+	for rows.Next() {
+		var u FollowUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt, &u.FollowedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *FollowersStore) IsFollowing(ctx context.Context, FollowerID int64, UserID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, query, UserID, FollowerID).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
 }
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// Mention is an @username in a post or comment that resolved to a user.
+// Start and End delimit it, @ included, in characters of the content.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// MentionedIn is a post, or a comment on one, that mentions a user.
+type MentionedIn struct {
+	ID        int64  `json:"id"`
+	PostID    int64  `json:"post_id"`
+	CommentID *int64 `json:"comment_id"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+	User      User   `json:"user"`
+}
+
+// An @ only starts a mention at the beginning of the text or after a
+// character that cannot be part of a username, so e-mail addresses are left
+// alone.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@])@([A-Za-z0-9_]{1,100})`)
+
+// usernamePattern accepts exactly the names mentionPattern can pick up. The
+// character class is spelled out because \w means more in Postgres, which
+// enforces the same rule on users.username.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,100}$`)
+
+// ValidUsername reports whether username can be registered and mentioned.
+func ValidUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+// parseMentions finds every @username in content. UserID is left unset.
+func parseMentions(content string) []Mention {
+	mentions := make([]Mention, 0)
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		at, end := m[2]-1, m[3]
+		start := utf8.RuneCountInString(content[:at])
+		mentions = append(mentions, Mention{
+			Username: content[m[2]:m[3]],
+			Start:    start,
+			End:      start + utf8.RuneCountInString(content[at:end]),
+		})
+	}
+	return mentions
+}
+
+// resolveMentions keeps the mentions in content of the users in userIDs, a
+// map from username to id, and fills in their ids.
+func resolveMentions(content string, userIDs map[string]int64) []Mention {
+	mentions := make([]Mention, 0)
+	for _, m := range parseMentions(content) {
+		if id, ok := userIDs[m.Username]; ok {
+			m.UserID = id
+			mentions = append(mentions, m)
+		}
+	}
+	return mentions
+}
+
+// saveMentions records who content, written by authorID, mentions. column
+// is either post_id or comment_id and targetID the row it belongs to.
+// Mentions no longer in content are dropped, and users who blocked the
+// author or were blocked by them are never recorded.
+func saveMentions(ctx context.Context, tx *sql.Tx, column string, targetID, authorID int64, content string) ([]Mention, error) {
+	usernames := make([]string, 0)
+	for _, m := range parseMentions(content) {
+		usernames = append(usernames, m.Username)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `DELETE FROM mentions m WHERE m.` + column + ` = $1 AND
+		NOT EXISTS (SELECT 1 FROM users u WHERE u.id = m.user_id AND u.username = ANY($2))`
+	if _, err := tx.ExecContext(ctx, query, targetID, pq.Array(usernames)); err != nil {
+		return nil, err
+	}
+	if len(usernames) == 0 {
+		return resolveMentions(content, nil), nil
+	}
+
+	query = `INSERT INTO mentions (user_id, ` + column + `)
+	SELECT u.id, $1 FROM users u
+	WHERE u.username = ANY($2) AND ` + notBlockedBetween("u.id", "$3::bigint") + `
+	ON CONFLICT DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, targetID, pq.Array(usernames), authorID); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT u.id, u.username FROM mentions m JOIN users u ON u.id = m.user_id WHERE m.` + column + ` = $1`
+	rows, err := tx.QueryContext(ctx, query, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := make(map[string]int64)
+	for rows.Next() {
+		var id int64
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		userIDs[username] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return resolveMentions(content, userIDs), nil
+}
+
+type MentionsStore struct {
+	db *sql.DB
+}
+
+// LoadForPosts fills in the Mentions of posts.
+func (s *MentionsStore) LoadForPosts(ctx context.Context, posts []*Post) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	userIDs, err := s.mentionedUsers(ctx, "post_id", ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		p.Mentions = resolveMentions(p.Content, userIDs[p.ID])
+	}
+	return nil
+}
+
+// LoadForComments fills in the Mentions of comments, but not of their
+// replies.
+func (s *MentionsStore) LoadForComments(ctx context.Context, comments []*Comment) error {
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	userIDs, err := s.mentionedUsers(ctx, "comment_id", ids)
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		c.Mentions = resolveMentions(c.Content, userIDs[c.ID])
+	}
+	return nil
+}
+
+// mentionedUsers maps each of the ids in column to the usernames and ids of
+// the users it mentions.
+func (s *MentionsStore) mentionedUsers(ctx context.Context, column string, ids []int64) (map[int64]map[string]int64, error) {
+	userIDs := make(map[int64]map[string]int64)
+	if len(ids) == 0 {
+		return userIDs, nil
+	}
+
+	query := `SELECT m.` + column + `, u.id, u.username
+	FROM mentions m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.` + column + ` = ANY($1)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var targetID, userID int64
+		var username string
+		if err := rows.Scan(&targetID, &userID, &username); err != nil {
+			return nil, err
+		}
+		if userIDs[targetID] == nil {
+			userIDs[targetID] = make(map[string]int64)
+		}
+		userIDs[targetID][username] = userID
+	}
+	return userIDs, rows.Err()
+}
+
+// GetByUserID returns the posts and comments mentioning the user, newest
+// first, leaving out those the user cannot see or whose author the user
+// muted or is blocked with.
+func (s *MentionsStore) GetByUserID(ctx context.Context, userID int64, mq MentionQuery) ([]MentionedIn, error) {
+	query := `SELECT m.id, p.id, c.id, p.title, coalesce(c.content, p.content), m.created_at, au.id, au.username
+	FROM mentions m
+	LEFT JOIN comments c ON c.id = m.comment_id AND c.deleted_at IS NULL
+	JOIN posts p ON p.id = coalesce(m.post_id, c.post_id)
+	JOIN users u ON u.id = p.user_id
+	JOIN users au ON au.id = coalesce(c.user_id, p.user_id)
+	WHERE m.user_id = $1 AND
+		(m.comment_id IS NULL OR c.id IS NOT NULL) AND
+		($2::timestamptz IS NULL OR (m.created_at, m.id) < ($2::timestamptz, $3::bigint)) AND
+		p.status = 'published' AND p.deleted_at IS NULL AND
+		` + postVisibleTo("$1::bigint") + ` AND
+		` + notHiddenFrom("p.user_id", "$1::bigint") + ` AND
+		` + notHiddenFrom("au.id", "$1::bigint") + `
+	ORDER BY m.created_at DESC, m.id DESC
+	LIMIT $4`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := mq.keysetArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, cursorCreatedAt, cursorID, mq.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := make([]MentionedIn, 0)
+	for rows.Next() {
+		var m MentionedIn
+		if err := rows.Scan(&m.ID, &m.PostID, &m.CommentID, &m.Title, &m.Content, &m.CreatedAt, &m.User.ID, &m.User.Username); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
@@ -1,6 +1,10 @@
 package store
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -15,6 +19,9 @@ type PaginatedFeedQuery struct {
 	Search string   `json:"search" validate:"omitempty,max=100"`
 	Since  string   `json:"since" validate:"omitempty"`
 	Until  string   `json:"until" validate:"omitempty"`
+	Cursor string   `json:"cursor" validate:"omitempty"`
+
+	cursor *Cursor
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -44,28 +51,561 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 
 	tags := qs.Get("tags")
 	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+		fq.Tags = postTags(strings.Split(tags, ","), "")
 	}
 	search := qs.Get("search")
 	if search != "" {
 		fq.Search = search
 	}
+	var sinceTime, untilTime time.Time
 	since := qs.Get("since")
 	if since != "" {
-		fq.Since = parseTime(since)
+		t, err := parseTime("since", since)
+		if err != nil {
+			return fq, err
+		}
+		sinceTime = t
+		fq.Since = t.Format(time.RFC3339)
 	}
 	until := qs.Get("until")
 	if until != "" {
-		fq.Until = parseTime(until)
+		t, err := parseTime("until", until)
+		if err != nil {
+			return fq, err
+		}
+		untilTime = t
+		fq.Until = t.Format(time.RFC3339)
+	}
+	if since != "" && until != "" && sinceTime.After(untilTime) {
+		return fq, errors.New("since must not be after until")
+	}
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return fq, err
+		}
+		fq.Cursor = cursor
+		fq.cursor = c
 	}
 
 	return fq, nil
 }
 
-func parseTime(s string) string {
-	t, err := time.Parse(time.DateTime, s)
+// parseTime accepts either RFC3339 or time.DateTime, the latter read as UTC.
+func parseTime(param, s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateTime, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid %s %q: expected RFC3339 (2006-01-02T15:04:05Z07:00) or %q", param, s, time.DateTime)
+}
+
+// PostsListQuery narrows a PaginatedFeedQuery down to a single author, given
+// either by id or by username.
+type PostsListQuery struct {
+	PaginatedFeedQuery
+	AuthorID int64  `json:"author_id" validate:"gte=0"`
+	Username string `json:"username" validate:"omitempty,max=255"`
+}
+
+func (lq PostsListQuery) Parse(r *http.Request) (PostsListQuery, error) {
+	fq, err := lq.PaginatedFeedQuery.Parse(r)
 	if err != nil {
-		return ""
+		return lq, err
+	}
+	lq.PaginatedFeedQuery = fq
+
+	qs := r.URL.Query()
+
+	authorID := qs.Get("author_id")
+	if authorID != "" {
+		authorIDInt, err := strconv.ParseInt(authorID, 10, 64)
+		if err != nil {
+			return lq, err
+		}
+		lq.AuthorID = authorIDInt
+	}
+	username := qs.Get("username")
+	if username != "" {
+		lq.Username = username
+	}
+
+	return lq, nil
+}
+
+// CommentTreeQuery controls how much of a comment thread GetTree loads.
+type CommentTreeQuery struct {
+	ParentID *int64 `json:"parent_id"`
+	Limit    int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset   int    `json:"offset" validate:"gte=0"`
+	Depth    int    `json:"depth" validate:"gte=1,lte=5"`
+	Sort     string `json:"sort" validate:"omitempty,oneof=newest oldest"`
+	Cursor   string `json:"cursor" validate:"omitempty"`
+
+	cursor *Cursor
+}
+
+func (ct CommentTreeQuery) Parse(r *http.Request) (CommentTreeQuery, error) {
+	qs := r.URL.Query()
+
+	parentID := qs.Get("parent_id")
+	if parentID != "" {
+		parentIDInt, err := strconv.ParseInt(parentID, 10, 64)
+		if err != nil {
+			return ct, err
+		}
+		ct.ParentID = &parentIDInt
+	}
+	limit := qs.Get("limit")
+	if limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return ct, err
+		}
+		ct.Limit = limitInt
+	}
+	offset := qs.Get("offset")
+	if offset != "" {
+		offsetInt, err := strconv.Atoi(offset)
+		if err != nil {
+			return ct, err
+		}
+		ct.Offset = offsetInt
+	}
+	depth := qs.Get("depth")
+	if depth != "" {
+		depthInt, err := strconv.Atoi(depth)
+		if err != nil {
+			return ct, err
+		}
+		ct.Depth = depthInt
+	}
+	sort := qs.Get("sort")
+	if sort != "" {
+		ct.Sort = sort
+	}
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return ct, err
+		}
+		ct.Cursor = cursor
+		ct.cursor = c
+	}
+
+	return ct, nil
+}
+
+func (ct CommentTreeQuery) keyset() (op, order string) {
+	if ct.Sort == "oldest" {
+		return ">", "asc"
+	}
+	return "<", "desc"
+}
+
+func (ct CommentTreeQuery) keysetArgs() (any, any) {
+	if ct.cursor == nil {
+		return nil, nil
+	}
+	return ct.cursor.CreatedAt, ct.cursor.ID
+}
+
+func (ct CommentTreeQuery) offset() int {
+	if ct.cursor != nil {
+		return 0
+	}
+	return ct.Offset
+}
+
+// CommentCursors returns the cursor to the page of root-level comments that
+// follows comments, the page returned for ct.
+func CommentCursors(ct CommentTreeQuery, comments []Comment) PageCursors {
+	var cursors PageCursors
+	if len(comments) == ct.Limit {
+		last := comments[len(comments)-1]
+		cursors.NextCursor = Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	return cursors
+}
+
+// FollowQuery pages through a user's followers or followings, most recent
+// follow first.
+type FollowQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Cursor string `json:"cursor" validate:"omitempty"`
+
+	cursor *Cursor
+}
+
+func (fq FollowQuery) Parse(r *http.Request) (FollowQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return fq, err
+		}
+		fq.Limit = limitInt
+	}
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return fq, err
+		}
+		fq.Cursor = cursor
+		fq.cursor = c
+	}
+
+	return fq, nil
+}
+
+func (fq FollowQuery) keysetArgs() (any, any) {
+	if fq.cursor == nil {
+		return nil, nil
+	}
+	return fq.cursor.CreatedAt, fq.cursor.ID
+}
+
+// FollowCursors returns the cursor to the page following users, the page
+// returned for fq.
+func FollowCursors(fq FollowQuery, users []FollowUser) PageCursors {
+	var cursors PageCursors
+	if len(users) == fq.Limit {
+		last := users[len(users)-1]
+		cursors.NextCursor = Cursor{CreatedAt: last.FollowedAt, ID: last.ID}.Encode()
+	}
+	return cursors
+}
+
+// BookmarkQuery pages through a user's bookmarks, most recently bookmarked
+// first, optionally within a single collection.
+type BookmarkQuery struct {
+	Limit        int    `json:"limit" validate:"gte=1,lte=100"`
+	CollectionID *int64 `json:"collection_id"`
+	Cursor       string `json:"cursor" validate:"omitempty"`
+
+	cursor *Cursor
+}
+
+func (bq BookmarkQuery) Parse(r *http.Request) (BookmarkQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return bq, err
+		}
+		bq.Limit = limitInt
+	}
+	collectionID := qs.Get("collection_id")
+	if collectionID != "" {
+		collectionIDInt, err := strconv.ParseInt(collectionID, 10, 64)
+		if err != nil {
+			return bq, err
+		}
+		bq.CollectionID = &collectionIDInt
+	}
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return bq, err
+		}
+		bq.Cursor = cursor
+		bq.cursor = c
+	}
+
+	return bq, nil
+}
+
+func (bq BookmarkQuery) keysetArgs() (any, any) {
+	if bq.cursor == nil {
+		return nil, nil
+	}
+	return bq.cursor.CreatedAt, bq.cursor.ID
+}
+
+// BookmarkCursors returns the cursor to the page following bookmarks, the
+// page returned for bq.
+func BookmarkCursors(bq BookmarkQuery, bookmarks []Feed) PageCursors {
+	var cursors PageCursors
+	if len(bookmarks) == bq.Limit {
+		last := bookmarks[len(bookmarks)-1]
+		cursors.NextCursor = Cursor{CreatedAt: last.BookmarkedAt, ID: last.ID}.Encode()
+	}
+	return cursors
+}
+
+// MentionQuery pages through the posts and comments mentioning a user,
+// newest first.
+type MentionQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Cursor string `json:"cursor" validate:"omitempty"`
+
+	cursor *Cursor
+}
+
+func (mq MentionQuery) Parse(r *http.Request) (MentionQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return mq, err
+		}
+		mq.Limit = limitInt
+	}
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return mq, err
+		}
+		mq.Cursor = cursor
+		mq.cursor = c
+	}
+
+	return mq, nil
+}
+
+func (mq MentionQuery) keysetArgs() (any, any) {
+	if mq.cursor == nil {
+		return nil, nil
+	}
+	return mq.cursor.CreatedAt, mq.cursor.ID
+}
+
+// MentionCursors returns the cursor to the page following mentions, the
+// page returned for mq.
+func MentionCursors(mq MentionQuery, mentions []MentionedIn) PageCursors {
+	var cursors PageCursors
+	if len(mentions) == mq.Limit {
+		last := mentions[len(mentions)-1]
+		cursors.NextCursor = Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	return cursors
+}
+
+// DraftQuery pages through a user's drafts and scheduled posts, most
+// recently created first.
+type DraftQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Cursor string `json:"cursor" validate:"omitempty"`
+
+	cursor *Cursor
+}
+
+func (dq DraftQuery) Parse(r *http.Request) (DraftQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return dq, err
+		}
+		dq.Limit = limitInt
+	}
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return dq, err
+		}
+		dq.Cursor = cursor
+		dq.cursor = c
+	}
+
+	return dq, nil
+}
+
+func (dq DraftQuery) keysetArgs() (any, any) {
+	if dq.cursor == nil {
+		return nil, nil
+	}
+	return dq.cursor.CreatedAt, dq.cursor.ID
+}
+
+// DraftCursors returns the cursor to the page following drafts, the page
+// returned for dq.
+func DraftCursors(dq DraftQuery, drafts []Post) PageCursors {
+	var cursors PageCursors
+	if len(drafts) == dq.Limit {
+		last := drafts[len(drafts)-1]
+		cursors.NextCursor = Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	return cursors
+}
+
+// SearchQuery is a search of one type of result, ranked by relevance and
+// therefore paginated by offset.
+type SearchQuery struct {
+	Q      string `json:"q" validate:"required,max=200"`
+	Type   string `json:"type" validate:"omitempty,oneof=posts comments users"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (sq SearchQuery) Parse(r *http.Request) (SearchQuery, error) {
+	qs := r.URL.Query()
+
+	sq.Q = strings.TrimSpace(qs.Get("q"))
+	searchType := qs.Get("type")
+	if searchType != "" {
+		sq.Type = searchType
+	}
+	limit := qs.Get("limit")
+	if limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return sq, err
+		}
+		sq.Limit = limitInt
+	}
+	offset := qs.Get("offset")
+	if offset != "" {
+		offsetInt, err := strconv.Atoi(offset)
+		if err != nil {
+			return sq, err
+		}
+		sq.Offset = offsetInt
+	}
+
+	return sq, nil
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of a row in a keyset-paginated listing. Clients only
+// ever see it as the opaque string produced by Encode.
+type Cursor struct {
+	CreatedAt string `json:"t"`
+	ID        int64  `json:"id"`
+	Backward  bool   `json:"b,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.CreatedAt == "" || c.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := time.Parse(time.RFC3339Nano, c.CreatedAt); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+type PageCursors struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// keyset returns the row comparison operator and the ORDER BY direction to
+// use for fq. Walking backward runs the query in the opposite order; the
+// caller must reverse the rows afterwards.
+func (fq PaginatedFeedQuery) keyset() (op, order string) {
+	backward := fq.cursor != nil && fq.cursor.Backward
+	switch {
+	case fq.Sort == "asc" && !backward:
+		return ">", "asc"
+	case fq.Sort == "asc" && backward:
+		return "<", "desc"
+	case backward:
+		return ">", "asc"
+	default:
+		return "<", "desc"
+	}
+}
+
+// keysetArgs returns the cursor position as query arguments, both NULL when
+// paginating by offset.
+func (fq PaginatedFeedQuery) keysetArgs() (any, any) {
+	if fq.cursor == nil {
+		return nil, nil
+	}
+	return fq.cursor.CreatedAt, fq.cursor.ID
+}
+
+// offset ignores the offset once the client has switched to cursors.
+func (fq PaginatedFeedQuery) offset() int {
+	if fq.cursor != nil {
+		return 0
+	}
+	return fq.Offset
+}
+
+func (fq PaginatedFeedQuery) isBackward() bool {
+	return fq.cursor != nil && fq.cursor.Backward
+}
+
+// FeedCursors builds the cursors pointing at the pages around feed, which is
+// the page returned for fq.
+func FeedCursors(fq PaginatedFeedQuery, feed []Feed) PageCursors {
+	var cursors PageCursors
+
+	if len(feed) == 0 {
+		if fq.cursor != nil {
+			c := *fq.cursor
+			c.Backward = !c.Backward
+			if c.Backward {
+				cursors.PrevCursor = c.Encode()
+			} else {
+				cursors.NextCursor = c.Encode()
+			}
+		}
+		return cursors
+	}
+
+	first, last := feed[0], feed[len(feed)-1]
+	prev := Cursor{CreatedAt: first.sortedAt(), ID: first.ID, Backward: true}.Encode()
+	next := Cursor{CreatedAt: last.sortedAt(), ID: last.ID}.Encode()
+	full := len(feed) == fq.Limit
+
+	if fq.isBackward() {
+		cursors.NextCursor = next
+		if full {
+			cursors.PrevCursor = prev
+		}
+		return cursors
+	}
+
+	if full {
+		cursors.NextCursor = next
+	}
+	if fq.cursor != nil || fq.Offset > 0 {
+		cursors.PrevCursor = prev
+	}
+	return cursors
+}
+
+// sortedAt is the time the feed is ordered by: when the post was reposted
+// if it came through a repost, when it was written otherwise.
+func (f Feed) sortedAt() string {
+	if f.RepostedAt != "" {
+		return f.RepostedAt
+	}
+	return f.CreatedAt
+}
+
+func reverseFeed(feed []Feed) {
+	for i, j := 0, len(feed)-1; i < j; i, j = i+1, j-1 {
+		feed[i], feed[j] = feed[j], feed[i]
 	}
-	return t.Format(time.DateTime)
 }
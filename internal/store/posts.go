@@ -14,21 +14,63 @@ import (
 
 // Post This is the Model
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Version   int       `json:"version"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID            int64           `json:"id"`
+	Content       string          `json:"content"`
+	Title         string          `json:"title"`
+	UserID        int64           `json:"user_id"`
+	Tags          []string        `json:"tags"`
+	CreatedAt     string          `json:"created_at"`
+	UpdatedAt     string          `json:"updated_at"`
+	Version       int             `json:"version"`
+	Comments      []Comment       `json:"comments"`
+	User          User            `json:"user"`
+	Visibility    string          `json:"visibility"`
+	Status        string          `json:"status"`
+	PublishAt     *string         `json:"publish_at"`
+	QuotedPostID  *int64          `json:"quoted_post_id"`
+	CommentsCount int             `json:"comments_count"`
+	RepostsCount  int             `json:"reposts_count"`
+	Reactions     ReactionSummary `json:"reactions"`
+	Mentions      []Mention       `json:"mentions"`
+	// ExplicitTags are the tags the post was given, without the hashtags
+	// Tags picks up from its content.
+	ExplicitTags []string `json:"-"`
 }
 
+// Post visibility levels.
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityOnlyMe    = "only_me"
+)
+
+// Post publication statuses. Only published posts show up in feeds and
+// listings; drafts and scheduled posts are visible to their author alone.
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+)
+
+// Reasons a post appears in a user's feed.
+const (
+	FeedReasonFollowing   = "following"
+	FeedReasonRepost      = "repost"
+	FeedReasonFollowedTag = "followed_tag"
+)
+
 type Feed struct {
 	Post
-	CommentsCount int `json:"comments_count"`
+	// Reason tells why the post is in the user's feed, one of the
+	// FeedReason constants. Set only in the feed.
+	Reason      string `json:"reason,omitempty"`
+	FollowedTag string `json:"followed_tag,omitempty"`
+	// Set only when the post reached the feed through a repost.
+	RepostedBy *Reposter `json:"reposted_by,omitempty"`
+	RepostedAt string    `json:"reposted_at,omitempty"`
+	// Set only when listing bookmarks.
+	CollectionID *int64 `json:"collection_id,omitempty"`
+	BookmarkedAt string `json:"bookmarked_at,omitempty"`
 }
 
 type PostsStore struct {
@@ -36,26 +78,44 @@ type PostsStore struct {
 }
 
 func (s *PostsStore) Create(ctx context.Context, post *Post) error {
-	query := `INSERT INTO posts (content, title, user_id, tags) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
+	query := `INSERT INTO posts (content, title, user_id, tags, explicit_tags, visibility, status, publish_at, quoted_post_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id, created_at, updated_at`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	tags := pq.Array(post.Tags)
-	err := s.db.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, tags).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
-	if err != nil {
-		return err
+	if post.Visibility == "" {
+		post.Visibility = VisibilityPublic
 	}
-	return nil
+	if post.Status == "" {
+		post.Status = StatusPublished
+	}
+	post.ExplicitTags = NormalizeTags(post.Tags)
+	post.Tags = postTags(post.ExplicitTags, post.Content)
+	post.Reactions = newReactionSummary()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		tags, explicitTags := pq.Array(post.Tags), pq.Array(post.ExplicitTags)
+		err := tx.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, tags, explicitTags, post.Visibility, post.Status, post.PublishAt, post.QuotedPostID).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		post.Mentions, err = saveMentions(ctx, tx, "post_id", post.ID, post.UserID, post.Content)
+		return err
+	})
 }
 
 func (s *PostsStore) GetById(ctx context.Context, postID int64) (*Post, error) {
-	query := `SELECT id, content, title, user_id, tags, created_at, updated_at, version FROM posts WHERE id = $1`
+	query := `SELECT id, content, title, user_id, tags, explicit_tags, created_at, updated_at, version, visibility, status, publish_at, quoted_post_id,
+		(SELECT count(*) FROM reposts r WHERE r.post_id = posts.id) AS reposts_count
+	FROM posts WHERE id = $1 AND deleted_at IS NULL`
 	var post Post
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, postID).Scan(&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version)
+	err := s.db.QueryRowContext(ctx, query, postID).Scan(&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), pq.Array(&post.ExplicitTags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Visibility, &post.Status, &post.PublishAt, &post.QuotedPostID, &post.RepostsCount)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -68,11 +128,12 @@ func (s *PostsStore) GetById(ctx context.Context, postID int64) (*Post, error) {
 	return &post, err
 }
 
-func (s *PostsStore) DeleteById(ctx context.Context, postID int64) error {
-	query := `DELETE FROM posts WHERE id = $1`
+// DeleteById soft deletes the post, provided it is still at version.
+func (s *PostsStore) DeleteById(ctx context.Context, postID int64, version int) error {
+	query := `UPDATE posts SET deleted_at = NOW() WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
-	res, err := s.db.ExecContext(ctx, query, postID)
+	res, err := s.db.ExecContext(ctx, query, postID, version)
 	if err != nil {
 		return err
 	}
@@ -81,13 +142,17 @@ func (s *PostsStore) DeleteById(ctx context.Context, postID int64) error {
 		return err
 	}
 	if rows == 0 {
-		return ErrNotFound
+		return staleOrMissing(ctx, s.db, postID, version)
 	}
 
 	return nil
 }
 
 func (s *PostsStore) Update(ctx context.Context, post *Post) error {
+	// Tags are recomputed rather than carried over, so hashtags edited out of
+	// the content stop tagging the post.
+	post.Tags = postTags(post.ExplicitTags, post.Content)
+
 	// Build dynamic query based on provided fields
 
 	updates := make([]string, 0)
@@ -115,17 +180,20 @@ func (s *PostsStore) Update(ctx context.Context, post *Post) error {
 		argPosition++
 	}
 
-	if len(post.Tags) > 0 {
-		updates = append(updates, fmt.Sprintf("tags = $%d", argPosition))
-		args = append(args, pq.Array(post.Tags))
+	if post.ExplicitTags != nil {
+		updates = append(updates, fmt.Sprintf("explicit_tags = $%d", argPosition))
+		args = append(args, pq.Array(post.ExplicitTags))
 		argPosition++
 	}
-	log.Println(updates)
 
-	// If no fields to update except updated_at, return the existing post
-	if len(updates) == 2 { // only updated_at
-		return nil
+	if post.Visibility != "" {
+		updates = append(updates, fmt.Sprintf("visibility = $%d", argPosition))
+		args = append(args, post.Visibility)
+		argPosition++
 	}
+	updates = append(updates, fmt.Sprintf("tags = $%d", argPosition))
+	args = append(args, pq.Array(post.Tags))
+	argPosition++
 
 	// Add ID to args
 	args = append(args, post.ID)
@@ -133,25 +201,111 @@ func (s *PostsStore) Update(ctx context.Context, post *Post) error {
 
 	// Construct final query
 	query := fmt.Sprintf(
-		"UPDATE posts SET %s WHERE id = $%d AND version = $%d RETURNING id, user_id, content, title, tags, created_at, updated_at, version",
+		"UPDATE posts SET %s WHERE id = $%d AND version = $%d AND deleted_at IS NULL RETURNING id, user_id, content, title, tags, explicit_tags, created_at, updated_at, version, visibility, status, publish_at, quoted_post_id",
 		strings.Join(updates, ", "),
 		argPosition,
 		argPosition+1,
 	)
+
+	// The version being replaced is archived in the same transaction, so the
+	// revision history never misses an edit.
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := archivePostRevision(ctx, tx, post.ID, post.Version); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		// Execute query and scan into new post
+		row := tx.QueryRowContext(ctx, query, args...)
+		if err := scanUpdatedPost(row, post); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return staleOrMissing(ctx, tx, post.ID, post.Version)
+			}
+			return err
+		}
+
+		var err error
+		post.Mentions, err = saveMentions(ctx, tx, "post_id", post.ID, post.UserID, post.Content)
+		return err
+	})
+}
+
+// Revert makes the title, content and tags of an earlier version of the post
+// current again. Like any other edit it creates a new version and archives
+// the one it replaces.
+func (s *PostsStore) Revert(ctx context.Context, post *Post, version int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := archivePostRevision(ctx, tx, post.ID, post.Version); err != nil {
+			return err
+		}
+
+		query := `UPDATE posts p SET title = pr.title, content = pr.content, tags = pr.tags,
+			explicit_tags = pr.explicit_tags, updated_at = NOW(), version = p.version + 1
+		FROM post_revisions pr
+		WHERE p.id = $1 AND p.version = $2 AND p.deleted_at IS NULL AND
+			pr.post_id = p.id AND pr.version = $3
+		RETURNING p.id, p.user_id, p.content, p.title, p.tags, p.explicit_tags, p.created_at, p.updated_at, p.version, p.visibility, p.status, p.publish_at, p.quoted_post_id`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		row := tx.QueryRowContext(ctx, query, post.ID, post.Version, version)
+		if err := scanUpdatedPost(row, post); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return staleOrMissing(ctx, tx, post.ID, post.Version)
+			}
+			return err
+		}
+
+		var err error
+		post.Mentions, err = saveMentions(ctx, tx, "post_id", post.ID, post.UserID, post.Content)
+		return err
+	})
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// staleOrMissing tells apart why an update guarded by a version check
+// matched no row: ErrEditConflict when the post has moved past version,
+// ErrNotFound when it is gone or, for a revert, the revision is.
+func staleOrMissing(ctx context.Context, q queryRower, postID int64, version int) error {
+	query := `SELECT version FROM posts WHERE id = $1 AND deleted_at IS NULL`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	// Execute query and scan into new post
-	row := s.db.QueryRowContext(ctx, query, args...)
+	var current int
+	err := q.QueryRowContext(ctx, query, postID).Scan(&current)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case err != nil:
+		return err
+	case current != version:
+		return ErrEditConflict
+	default:
+		return ErrNotFound
+	}
+}
+
+func scanUpdatedPost(row *sql.Row, post *Post) error {
 	err := row.Scan(
 		&post.ID,
 		&post.UserID,
 		&post.Content,
 		&post.Title,
 		pq.Array(&post.Tags),
+		pq.Array(&post.ExplicitTags),
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.Version,
+		&post.Visibility,
+		&post.Status,
+		&post.PublishAt,
+		&post.QuotedPostID,
 	)
 	if err != nil {
 		switch {
@@ -161,36 +315,87 @@ func (s *PostsStore) Update(ctx context.Context, post *Post) error {
 			return err
 		}
 	}
-
-	return err
+	return nil
 }
 
 func (s *PostsStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]Feed, error) {
-	query := `select p.id,
+	op, order := fq.keyset()
+	// Most posts are already materialized in the user's timeline; posts from
+	// followed authors too large to fan out to are pulled here instead, and
+	// so are posts reposted by followed users and posts carrying a followed
+	// tag. A post arriving several ways is shown once: as itself if it was
+	// written by someone followed, otherwise as its latest repost, placed at
+	// the time of that repost, and otherwise for its followed tag.
+	query := `with pulled_authors as (
+					select f.user_id
+					from followers f
+					where f.follower_id = $1
+					  and (select count(*) from followers f2 where f2.user_id = f.user_id) > $10
+				),
+				followed_tags as (
+					select coalesce(array_agg(tf.tag), '{}') as tags from tag_follows tf where tf.user_id = $1
+				),
+				feed_posts as (
+					select t.post_id, 0 as rank, '` + FeedReasonFollowing + `' as reason,
+						null::bigint as reposted_by, null::timestamptz as reposted_at, null::varchar as followed_tag
+					from timelines t where t.user_id = $1
+					union all
+					select p.id, 0, '` + FeedReasonFollowing + `', null, null, null
+					from posts p join pulled_authors pa on pa.user_id = p.user_id
+					union all
+					select r.post_id, 1, '` + FeedReasonRepost + `', r.user_id, r.created_at, null
+					from reposts r
+					         join followers f on f.user_id = r.user_id and f.follower_id = $1
+					where ` + notHiddenFrom("r.user_id", "$1::bigint") + `
+					union all
+					select p.id, 2, '` + FeedReasonFollowedTag + `', null, null,
+						(select tag from unnest(p.tags) tag where tag = any(ft.tags) order by tag limit 1)
+					from posts p, followed_tags ft
+					where p.tags && ft.tags
+				),
+				feed_entries as (
+					select distinct on (post_id) post_id, reason, reposted_by, reposted_at, followed_tag
+					from feed_posts
+					order by post_id, rank, reposted_at desc
+				)
+				select p.id,
        				 p.user_id,
        				 p.title,
        				 p.content,
        				 p.created_at,
        				 p.version,
        				 p.tags,
+       				 p.visibility,
+       				 p.quoted_post_id,
        				 u.username,
-       				 count(c.id) as comments_count
-				from posts p
-				         left join comments c on c.post_id = p.id
-				         left join followers f on f.follower_id = p.user_id or p.user_id = $1
+       				 (select count(*) from comments c where c.post_id = p.id and c.deleted_at is null) as comments_count,
+       				 (select count(*) from reposts r where r.post_id = p.id) as reposts_count,
+       				 fe.reason,
+       				 fe.followed_tag,
+       				 fe.reposted_by,
+       				 ru.username,
+       				 fe.reposted_at
+				from feed_entries fe
+				         join posts p on p.id = fe.post_id
 				         join users u on p.user_id = u.id
+				         left join users ru on ru.id = fe.reposted_by
 				where 
-				f.user_id = $1 AND
 				(p.title ilike '%' || $4 || '%' or p.content ilike '%' || $4 || '%') AND 
-				($5::varchar[] is null OR array_length($5::varchar[], 1) is null OR p.tags && $5::varchar[])
-				GROUP BY p.id, u.username, p.created_at
-				order by p.created_at ` + fq.Sort + `
+				($5::varchar[] is null OR array_length($5::varchar[], 1) is null OR p.tags && $5::varchar[]) AND
+				($6::timestamptz is null OR (coalesce(fe.reposted_at, p.created_at), p.id) ` + op + ` ($6::timestamptz, $7::bigint)) AND
+				($8::timestamptz is null OR p.created_at >= $8::timestamptz) AND
+				($9::timestamptz is null OR p.created_at <= $9::timestamptz) AND
+				p.status = 'published' AND p.deleted_at is null AND
+				` + postVisibleTo("$1::bigint") + ` AND
+				` + notHiddenFrom("p.user_id", "$1::bigint") + `
+				order by coalesce(fe.reposted_at, p.created_at) ` + order + `, p.id ` + order + `
 				limit $2 offset $3`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	cursorCreatedAt, cursorID := fq.keysetArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.offset(), fq.Search, pq.Array(fq.Tags), cursorCreatedAt, cursorID, nullableTime(fq.Since), nullableTime(fq.Until), FanOutMaxFollowers)
 	if err != nil {
 		return nil, err
 	}
@@ -205,10 +410,268 @@ func (s *PostsStore) GetUserFeed(ctx context.Context, userID int64, fq Paginated
 	for rows.Next() {
 		var f Feed
 		f.User = User{}
-		if err := rows.Scan(&f.ID, &f.UserID, &f.Title, &f.Content, &f.CreatedAt, &f.Version, pq.Array(&f.Tags), &f.User.Username, &f.CommentsCount); err != nil {
+		var repostedByID *int64
+		var followedTag, repostedByUsername, repostedAt *string
+		if err := rows.Scan(&f.ID, &f.UserID, &f.Title, &f.Content, &f.CreatedAt, &f.Version, pq.Array(&f.Tags), &f.Visibility, &f.QuotedPostID, &f.User.Username, &f.CommentsCount, &f.RepostsCount, &f.Reason, &followedTag, &repostedByID, &repostedByUsername, &repostedAt); err != nil {
 			return nil, err
 		}
+		if followedTag != nil {
+			f.FollowedTag = *followedTag
+		}
+		if repostedByID != nil {
+			f.RepostedBy = &Reposter{ID: *repostedByID, Username: *repostedByUsername}
+			f.RepostedAt = *repostedAt
+		}
 		feeds = append(feeds, f)
 	}
+	if fq.isBackward() {
+		reverseFeed(feeds)
+	}
 	return feeds, nil
 }
+
+// List returns the posts matching lq that viewerID may see; pass 0 for
+// anonymous callers, who only see posts from public accounts.
+func (s *PostsStore) List(ctx context.Context, viewerID int64, lq PostsListQuery) ([]Feed, error) {
+	op, order := lq.keyset()
+	query := `SELECT p.id,
+				   p.user_id,
+				   p.title,
+				   p.content,
+				   p.created_at,
+				   p.version,
+				   p.tags,
+				   p.visibility,
+				   p.quoted_post_id,
+				   u.username,
+				   count(c.id) AS comments_count,
+				   (SELECT count(*) FROM reposts r WHERE r.post_id = p.id) AS reposts_count
+			FROM posts p
+					 JOIN users u ON p.user_id = u.id
+					 LEFT JOIN comments c ON c.post_id = p.id AND c.deleted_at IS NULL
+			WHERE
+				($1 = 0 OR p.user_id = $1) AND
+				($2 = '' OR u.username = $2) AND
+				(p.title ILIKE '%' || $3 || '%' OR p.content ILIKE '%' || $3 || '%') AND
+				($4::varchar[] IS NULL OR array_length($4::varchar[], 1) IS NULL OR p.tags && $4::varchar[]) AND
+				($5::timestamptz IS NULL OR p.created_at >= $5::timestamptz) AND
+				($6::timestamptz IS NULL OR p.created_at <= $6::timestamptz) AND
+				($9::timestamptz IS NULL OR (p.created_at, p.id) ` + op + ` ($9::timestamptz, $10::bigint)) AND
+				p.status = 'published' AND p.deleted_at IS NULL AND
+				` + postVisibleTo("$11::bigint") + `
+			GROUP BY p.id, u.username
+			ORDER BY p.created_at ` + order + `, p.id ` + order + `
+			LIMIT $7 OFFSET $8`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := lq.keysetArgs()
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		lq.AuthorID,
+		lq.Username,
+		lq.Search,
+		pq.Array(lq.Tags),
+		nullableTime(lq.Since),
+		nullableTime(lq.Until),
+		lq.Limit,
+		lq.offset(),
+		cursorCreatedAt,
+		cursorID,
+		viewerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]Feed, 0)
+	for rows.Next() {
+		var f Feed
+		if err := rows.Scan(&f.ID, &f.UserID, &f.Title, &f.Content, &f.CreatedAt, &f.Version, pq.Array(&f.Tags), &f.Visibility, &f.QuotedPostID, &f.User.Username, &f.CommentsCount, &f.RepostsCount); err != nil {
+			return nil, err
+		}
+		f.User.ID = f.UserID
+		posts = append(posts, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if lq.isBackward() {
+		reverseFeed(posts)
+	}
+	return posts, nil
+}
+
+// GetDrafts returns the user's drafts and scheduled posts, most recently
+// created first.
+func (s *PostsStore) GetDrafts(ctx context.Context, userID int64, dq DraftQuery) ([]Post, error) {
+	query := `SELECT id, content, title, user_id, tags, created_at, updated_at, version, visibility, status, publish_at
+	FROM posts
+	WHERE user_id = $1 AND status <> 'published' AND deleted_at IS NULL AND
+		($2::timestamptz IS NULL OR (created_at, id) < ($2::timestamptz, $3::bigint))
+	ORDER BY created_at DESC, id DESC
+	LIMIT $4`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := dq.keysetArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, cursorCreatedAt, cursorID, dq.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]Post, 0)
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(&p.ID, &p.Content, &p.Title, &p.UserID, pq.Array(&p.Tags), &p.CreatedAt, &p.UpdatedAt, &p.Version, &p.Visibility, &p.Status, &p.PublishAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// Publish publishes a draft or scheduled post right away, or schedules it
+// when publishAt is set. A post takes its publication time as created_at so
+// that it lands at the top of feeds rather than where it was first drafted.
+func (s *PostsStore) Publish(ctx context.Context, post *Post, publishAt *string) error {
+	query := `UPDATE posts SET
+		status = CASE WHEN $2::timestamptz IS NULL THEN 'published' ELSE 'scheduled' END,
+		publish_at = COALESCE($2::timestamptz, NOW()),
+		created_at = CASE WHEN $2::timestamptz IS NULL THEN NOW() ELSE created_at END,
+		updated_at = NOW(), version = version + 1
+	WHERE id = $1 AND status <> 'published' AND deleted_at IS NULL
+	RETURNING status, publish_at, created_at, updated_at, version`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := archiveCurrentRevision(ctx, tx, post.ID); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, post.ID, publishAt).Scan(&post.Status, &post.PublishAt, &post.CreatedAt, &post.UpdatedAt, &post.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrAlreadyPublished
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PublishDue publishes up to limit scheduled posts whose time has come and
+// returns their ids. Rows are claimed with SKIP LOCKED, so API replicas
+// running this concurrently each publish a disjoint set and every post is
+// published exactly once.
+func (s *PostsStore) PublishDue(ctx context.Context, limit int) ([]int64, error) {
+	query := `WITH due AS (
+		SELECT id, version, title, content, tags, explicit_tags, updated_at FROM posts
+		WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+		ORDER BY publish_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	),
+	archived AS (
+		INSERT INTO post_revisions (post_id, version, title, content, tags, explicit_tags, created_at)
+		SELECT id, version, title, content, tags, explicit_tags, updated_at FROM due
+		ON CONFLICT (post_id, version) DO NOTHING
+	)
+	UPDATE posts p SET status = 'published', created_at = p.publish_at, updated_at = NOW(), version = p.version + 1
+	FROM due
+	WHERE p.id = due.id
+	RETURNING p.id`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Restore undoes the soft delete of a post by its author, provided it was
+// deleted less than graceWindow ago.
+func (s *PostsStore) Restore(ctx context.Context, postID, userID int64, graceWindow time.Duration) error {
+	query := `UPDATE posts SET deleted_at = NULL, version = version + 1
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL AND deleted_at > $3`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := archiveCurrentRevision(ctx, tx, postID); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, postID, userID, time.Now().Add(-graceWindow))
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// PurgeDeleted permanently removes up to limit posts soft deleted more than
+// retention ago, along with their comments, and returns how many posts went.
+func (s *PostsStore) PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int64, error) {
+	query := `WITH expired AS (
+		SELECT id FROM posts WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2 FOR UPDATE SKIP LOCKED
+	),
+	purged_comments AS (
+		DELETE FROM comments c USING expired e WHERE c.post_id = e.id
+	)
+	DELETE FROM posts p USING expired e WHERE p.id = e.id`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, time.Now().Add(-retention), limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// postVisibleTo is a SQL condition that holds when viewer may see the post p
+// written by u: authors see all their posts; others never see only_me posts,
+// see followers-only posts and posts from private accounts only when they
+// follow the author, and see every other post.
+func postVisibleTo(viewer string) string {
+	return fmt.Sprintf(`(p.user_id = %[1]s OR (p.visibility <> 'only_me' AND (
+		(p.visibility = 'public' AND NOT u.is_private) OR
+		EXISTS (SELECT 1 FROM followers fl WHERE fl.user_id = p.user_id AND fl.follower_id = %[1]s))))`, viewer)
+}
+
+// nullableTime turns an unset time filter into a SQL NULL so the query can
+// skip it.
+func nullableTime(t string) any {
+	if t == "" {
+		return nil
+	}
+	return t
+}
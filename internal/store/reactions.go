@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// ReactionTypes is the fixed set of reactions a user can leave on a post.
+var ReactionTypes = []string{"like", "love", "laugh"}
+
+type ReactionSummary struct {
+	Counts      map[string]int `json:"counts"`
+	ReactedByMe bool           `json:"reacted_by_me"`
+	MyReaction  string         `json:"my_reaction,omitempty"`
+}
+
+func newReactionSummary() ReactionSummary {
+	counts := make(map[string]int, len(ReactionTypes))
+	for _, t := range ReactionTypes {
+		counts[t] = 0
+	}
+	return ReactionSummary{Counts: counts}
+}
+
+type ReactionsStore struct {
+	db *sql.DB
+}
+
+// Set records the user's reaction to the post, replacing any previous one.
+func (s *ReactionsStore) Set(ctx context.Context, postID, userID int64, reaction string) error {
+	query := `INSERT INTO post_reactions (user_id, post_id, reaction) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, post_id) DO UPDATE SET reaction = EXCLUDED.reaction, created_at = NOW()`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, postID, reaction)
+	return err
+}
+
+func (s *ReactionsStore) Remove(ctx context.Context, postID, userID int64) error {
+	query := `DELETE FROM post_reactions WHERE user_id = $1 AND post_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetSummaries aggregates the reactions of each post in postIDs. userID is
+// the caller, used for the "reacted by me" fields; pass 0 when anonymous.
+func (s *ReactionsStore) GetSummaries(ctx context.Context, postIDs []int64, userID int64) (map[int64]ReactionSummary, error) {
+	query := `SELECT post_id, reaction, count(*), bool_or(user_id = $2)
+	FROM post_reactions
+	WHERE post_id = ANY($1)
+	GROUP BY post_id, reaction`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make(map[int64]ReactionSummary, len(postIDs))
+	for _, id := range postIDs {
+		summaries[id] = newReactionSummary()
+	}
+	for rows.Next() {
+		var (
+			postID   int64
+			reaction string
+			count    int
+			mine     bool
+		)
+		if err := rows.Scan(&postID, &reaction, &count, &mine); err != nil {
+			return nil, err
+		}
+		summary := summaries[postID]
+		summary.Counts[reaction] = count
+		if mine {
+			summary.ReactedByMe = true
+			summary.MyReaction = reaction
+		}
+		summaries[postID] = summary
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Reposter is the followed user a post reached the feed through.
+type Reposter struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type RepostsStore struct {
+	db *sql.DB
+}
+
+// Create shares the post with the user's followers. Nothing is shared when
+// the user and the author have blocked one another.
+func (s *RepostsStore) Create(ctx context.Context, userID, postID int64) error {
+	query := `INSERT INTO reposts (user_id, post_id)
+	SELECT $1, $2
+	WHERE ` + notBlockedBetween("$1::bigint", "(SELECT user_id FROM posts WHERE id = $2)")
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrDuplicateKeyConflict
+		}
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrBlocked
+	}
+	return nil
+}
+
+func (s *RepostsStore) Delete(ctx context.Context, userID, postID int64) error {
+	query := `DELETE FROM reposts WHERE user_id = $1 AND post_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// PostRevision is a snapshot of a post's title, content and tags at one of
+// its versions. CreatedAt is when that version was written.
+type PostRevision struct {
+	PostID    int64    `json:"post_id"`
+	Version   int      `json:"version"`
+	Title     string   `json:"title"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"created_at"`
+}
+
+type PostRevisionsStore struct {
+	db *sql.DB
+}
+
+// Earlier versions are read from post_revisions; the current one still lives
+// in posts.
+const postRevisionsQuery = `SELECT post_id, version, title, content, tags, created_at
+	FROM post_revisions
+	WHERE post_id = $1
+	UNION ALL
+	SELECT id, version, title, content, tags, updated_at
+	FROM posts
+	WHERE id = $1 AND deleted_at IS NULL`
+
+// GetByPostID returns every version of the post, newest first.
+func (s *PostRevisionsStore) GetByPostID(ctx context.Context, postID int64) ([]PostRevision, error) {
+	query := `SELECT * FROM (` + postRevisionsQuery + `) r ORDER BY version DESC`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]PostRevision, 0)
+	for rows.Next() {
+		var pr PostRevision
+		if err := rows.Scan(&pr.PostID, &pr.Version, &pr.Title, &pr.Content, pq.Array(&pr.Tags), &pr.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, pr)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *PostRevisionsStore) GetByVersion(ctx context.Context, postID int64, version int) (*PostRevision, error) {
+	query := `SELECT * FROM (` + postRevisionsQuery + `) r WHERE version = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var pr PostRevision
+	err := s.db.QueryRowContext(ctx, query, postID, version).Scan(&pr.PostID, &pr.Version, &pr.Title, &pr.Content, pq.Array(&pr.Tags), &pr.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &pr, nil
+}
+
+// archivePostRevision copies the post as it is at version into
+// post_revisions, ahead of an update replacing it. Nothing is copied when
+// the post has since moved on to another version; the update that follows
+// then fails its own version check.
+func archivePostRevision(ctx context.Context, tx *sql.Tx, postID int64, version int) error {
+	query := `INSERT INTO post_revisions (post_id, version, title, content, tags, explicit_tags, created_at)
+	SELECT id, version, title, content, tags, explicit_tags, updated_at
+	FROM posts
+	WHERE id = $1 AND version = $2
+	ON CONFLICT (post_id, version) DO NOTHING`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, postID, version)
+	return err
+}
+
+// archiveCurrentRevision locks the post and archives whatever version it is
+// at, for changes such as publishing or restoring that bump the version
+// without checking it first. A missing post is left for the caller's own
+// update to report.
+func archiveCurrentRevision(ctx context.Context, tx *sql.Tx, postID int64) error {
+	query := `SELECT version FROM posts WHERE id = $1 FOR UPDATE`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var version int
+	err := tx.QueryRowContext(ctx, query, postID).Scan(&version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return err
+	}
+	return archivePostRevision(ctx, tx, postID, version)
+}
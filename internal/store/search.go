@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Search result types.
+const (
+	SearchPosts    = "posts"
+	SearchComments = "comments"
+	SearchUsers    = "users"
+)
+
+// SearchResult is a post, comment or user matching a search. Snippet holds
+// the matching parts of the text with the search terms wrapped in <mark>
+// tags; the rest of it is HTML-escaped.
+type SearchResult struct {
+	Type      string  `json:"type"`
+	ID        int64   `json:"id"`
+	PostID    *int64  `json:"post_id,omitempty"`
+	Title     string  `json:"title,omitempty"`
+	Snippet   string  `json:"snippet,omitempty"`
+	Rank      float64 `json:"rank"`
+	CreatedAt string  `json:"created_at"`
+	User      User    `json:"user"`
+}
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+// Search runs sq for viewerID, pass 0 for anonymous callers, and returns the
+// best matches first. Posts and comments are matched by full-text search, in
+// websearch_to_tsquery syntax; users by username prefix, falling back to
+// trigram similarity for misspelled names. Whatever viewerID cannot see is
+// left out.
+func (s *SearchStore) Search(ctx context.Context, viewerID int64, sq SearchQuery) ([]SearchResult, error) {
+	var query string
+	switch sq.Type {
+	case SearchComments:
+		query = `SELECT c.id, c.post_id, '', ` + headline("c.content") + `,
+			ts_rank_cd(c.search_vector, q.query), c.created_at, cu.id, cu.username
+		FROM comments c
+		CROSS JOIN websearch_to_tsquery('english', $1) AS q(query)
+		JOIN posts p ON p.id = c.post_id
+		JOIN users u ON u.id = p.user_id
+		JOIN users cu ON cu.id = c.user_id
+		WHERE c.search_vector @@ q.query AND c.deleted_at IS NULL AND
+			p.status = 'published' AND p.deleted_at IS NULL AND
+			` + postVisibleTo("$2::bigint") + ` AND
+			` + notHiddenFrom("p.user_id", "$2::bigint") + ` AND
+			` + notHiddenFrom("c.user_id", "$2::bigint") + `
+		ORDER BY 5 DESC, c.created_at DESC, c.id DESC
+		LIMIT $3 OFFSET $4`
+	case SearchUsers:
+		query = `SELECT u.id, NULL::bigint, '', '',
+			CASE WHEN u.username ILIKE ` + likePrefix("$1") + ` THEN 1 + similarity(u.username, $1) ELSE similarity(u.username, $1) END,
+			u.created_at, u.id, u.username
+		FROM users u
+		WHERE u.is_active AND
+			(u.username ILIKE ` + likePrefix("$1") + ` OR u.username % $1) AND
+			` + notBlockedBetween("u.id", "$2::bigint") + `
+		ORDER BY 5 DESC, u.username
+		LIMIT $3 OFFSET $4`
+	default:
+		query = `SELECT p.id, NULL::bigint, p.title, ` + headline("p.content") + `,
+			ts_rank_cd(p.search_vector, q.query), p.created_at, u.id, u.username
+		FROM posts p
+		CROSS JOIN websearch_to_tsquery('english', $1) AS q(query)
+		JOIN users u ON u.id = p.user_id
+		WHERE p.search_vector @@ q.query AND
+			p.status = 'published' AND p.deleted_at IS NULL AND
+			` + postVisibleTo("$2::bigint") + ` AND
+			` + notHiddenFrom("p.user_id", "$2::bigint") + `
+		ORDER BY 5 DESC, p.created_at DESC, p.id DESC
+		LIMIT $3 OFFSET $4`
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, sq.Q, viewerID, sq.Limit, sq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resultType := sq.Type
+	if resultType == "" {
+		resultType = SearchPosts
+	}
+	results := make([]SearchResult, 0)
+	for rows.Next() {
+		sr := SearchResult{Type: resultType}
+		if err := rows.Scan(&sr.ID, &sr.PostID, &sr.Title, &sr.Snippet, &sr.Rank, &sr.CreatedAt, &sr.User.ID, &sr.User.Username); err != nil {
+			return nil, err
+		}
+		results = append(results, sr)
+	}
+	return results, rows.Err()
+}
+
+// likePrefix is a LIKE pattern, with its ESCAPE clause, matching whatever
+// starts with the text of param. The LIKE wildcards and the escape character
+// in param are escaped so that they match only themselves.
+func likePrefix(param string) string {
+	return fmt.Sprintf(`replace(replace(replace(%s, '\', '\\'), '%%', '\%%'), '_', '\_') || '%%' ESCAPE '\'`, param)
+}
+
+// headline is a SQL expression giving the fragments of the column that best
+// match the query q.query. The text is HTML-escaped first so that only the
+// <mark> tags added around the matches are markup.
+func headline(column string) string {
+	escaped := fmt.Sprintf(`replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`, column)
+	return fmt.Sprintf(`ts_headline('english', %s, q.query,
+		'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2')`, escaped)
+}
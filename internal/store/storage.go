@@ -10,7 +10,16 @@ import (
 var (
 	ErrNotFound             = errors.New("resource not found")
 	ErrDuplicateKeyConflict = errors.New("duplicate key value violates unique constraint")
+	ErrDuplicateEmail       = errors.New("a user with that email already exists")
+	ErrDuplicateUsername    = errors.New("a user with that username already exists")
+	ErrBlocked              = errors.New("action not allowed between these users")
+	ErrAlreadyPublished     = errors.New("post is already published")
+	ErrEditConflict         = errors.New("post was modified by another request")
 	QueryTimeOutDuration    = time.Second * 5
+
+	// FanOutMaxFollowers is the follower count above which an author's posts
+	// are no longer copied into timelines but pulled when the feed is read.
+	FanOutMaxFollowers = 10_000
 )
 
 type Storage struct {
@@ -18,32 +27,137 @@ type Storage struct {
 		Create(context.Context, *Post) error
 		GetById(context.Context, int64) (*Post, error)
 		Update(context.Context, *Post) error
-		DeleteById(context.Context, int64) error
+		Revert(ctx context.Context, post *Post, version int) error
+		DeleteById(ctx context.Context, postID int64, version int) error
 		GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]Feed, error)
+		List(ctx context.Context, viewerID int64, lq PostsListQuery) ([]Feed, error)
+		GetDrafts(ctx context.Context, userID int64, dq DraftQuery) ([]Post, error)
+		Publish(ctx context.Context, post *Post, publishAt *string) error
+		PublishDue(ctx context.Context, limit int) ([]int64, error)
+		Restore(ctx context.Context, postID, userID int64, graceWindow time.Duration) error
+		PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int64, error)
 	}
 
 	Users interface {
 		Create(context.Context, *User) error
 		GetById(ctx context.Context, userID int64) (*User, error)
+		GetByEmail(ctx context.Context, email string) (*User, error)
+		GetStats(ctx context.Context, userID int64) (*UserStats, error)
+		Update(ctx context.Context, user *User) error
+		CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, send func() error) error
+		PurgeUnactivated(ctx context.Context, limit int) (int64, error)
+		Activate(ctx context.Context, token string) error
 	}
 	Comments interface {
-		GetByPostID(ctx context.Context, postID int64) ([]Comment, error)
+		GetByPostID(ctx context.Context, postID int64, viewerID int64, ct CommentTreeQuery) ([]Comment, error)
+		CountByPostID(ctx context.Context, postID int64) (int, error)
+		PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int64, error)
 		Create(ctx context.Context, c *Comment) error
 		DeleteById(ctx context.Context, commentID int64) error
 		GetById(ctx context.Context, commentID int64) (*Comment, error)
 		Update(ctx context.Context, c *Comment) error
 	}
+	FollowRequests interface {
+		Create(ctx context.Context, RequesterID int64, UserID int64) error
+		GetByUserID(ctx context.Context, userID int64) ([]FollowRequest, error)
+		Accept(ctx context.Context, UserID int64, RequesterID int64) error
+		Reject(ctx context.Context, UserID int64, RequesterID int64) error
+		AcceptAll(ctx context.Context, UserID int64) ([]int64, error)
+	}
+	Blocks interface {
+		Block(ctx context.Context, BlockerID int64, BlockedID int64) error
+		Unblock(ctx context.Context, BlockerID int64, BlockedID int64) error
+	}
+	Mutes interface {
+		Mute(ctx context.Context, MuterID int64, MutedID int64) error
+		Unmute(ctx context.Context, MuterID int64, MutedID int64) error
+	}
+	Timelines interface {
+		FanOutPost(ctx context.Context, postID int64) error
+		Backfill(ctx context.Context, userID, authorID int64, limit int) error
+		RemoveAuthor(ctx context.Context, userID, authorID int64) error
+	}
+	PostRevisions interface {
+		GetByPostID(ctx context.Context, postID int64) ([]PostRevision, error)
+		GetByVersion(ctx context.Context, postID int64, version int) (*PostRevision, error)
+	}
+	Bookmarks interface {
+		Set(ctx context.Context, userID, postID int64, collectionID *int64) error
+		Remove(ctx context.Context, userID, postID int64) error
+		GetByUserID(ctx context.Context, userID int64, bq BookmarkQuery) ([]Feed, error)
+	}
+	BookmarkCollections interface {
+		Create(ctx context.Context, c *BookmarkCollection) error
+		GetByUserID(ctx context.Context, userID int64) ([]BookmarkCollection, error)
+		Delete(ctx context.Context, userID, collectionID int64) error
+	}
+	Mentions interface {
+		LoadForPosts(ctx context.Context, posts []*Post) error
+		LoadForComments(ctx context.Context, comments []*Comment) error
+		GetByUserID(ctx context.Context, userID int64, mq MentionQuery) ([]MentionedIn, error)
+	}
+	Reposts interface {
+		Create(ctx context.Context, userID, postID int64) error
+		Delete(ctx context.Context, userID, postID int64) error
+	}
+	Tags interface {
+		RefreshTrending(ctx context.Context, recent, baseline time.Duration, minCount, limit int) error
+		GetTrending(ctx context.Context, limit int) ([]TrendingTag, error)
+		Follow(ctx context.Context, userID int64, tag string) error
+		Unfollow(ctx context.Context, userID int64, tag string) error
+	}
+	Search interface {
+		Search(ctx context.Context, viewerID int64, sq SearchQuery) ([]SearchResult, error)
+	}
+	Reactions interface {
+		Set(ctx context.Context, postID, userID int64, reaction string) error
+		Remove(ctx context.Context, postID, userID int64) error
+		GetSummaries(ctx context.Context, postIDs []int64, userID int64) (map[int64]ReactionSummary, error)
+	}
+	Roles interface {
+		GetByName(ctx context.Context, name string) (*Role, error)
+	}
 	Followers interface {
 		Follow(ctx context.Context, FollowerID int64, UserID int64) error
 		UnFollow(ctx context.Context, FollowerID int64, UserID int64) error
+		IsFollowing(ctx context.Context, FollowerID int64, UserID int64) (bool, error)
+		GetFollowers(ctx context.Context, userID int64, fq FollowQuery) ([]FollowUser, error)
+		GetFollowing(ctx context.Context, userID int64, fq FollowQuery) ([]FollowUser, error)
 	}
 }
 
 func NewPostgresStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostsStore{db},
-		Users:     &UsersStore{db},
-		Comments:  &CommentsStore{db},
-		Followers: &FollowersStore{db},
+		Posts:               &PostsStore{db},
+		Users:               &UsersStore{db},
+		Comments:            &CommentsStore{db},
+		Followers:           &FollowersStore{db},
+		Roles:               &RolesStore{db},
+		Timelines:           &TimelinesStore{db},
+		Reactions:           &ReactionsStore{db},
+		PostRevisions:       &PostRevisionsStore{db},
+		Bookmarks:           &BookmarksStore{db},
+		Reposts:             &RepostsStore{db},
+		Mentions:            &MentionsStore{db},
+		Tags:                &TagsStore{db},
+		Search:              &SearchStore{db},
+		BookmarkCollections: &BookmarkCollectionsStore{db},
+		FollowRequests:      &FollowRequestsStore{db},
+		Blocks:              &BlocksStore{db},
+		Mutes:               &MutesStore{db},
+	}
+}
+
+func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TrendingTag is a tag whose use over the recent window outpaces its usual
+// rate over the baseline window. Score is the ratio between the two rates.
+type TrendingTag struct {
+	Tag           string  `json:"tag"`
+	RecentCount   int     `json:"recent_count"`
+	BaselineCount int     `json:"baseline_count"`
+	Score         float64 `json:"score"`
+	RefreshedAt   string  `json:"refreshed_at"`
+}
+
+// MaxTagLength is the length, in characters, of the tag columns.
+const MaxTagLength = 255
+
+// As with mentions, a # only starts a hashtag at the beginning of the text or
+// after a character that cannot be part of one, which leaves URL fragments
+// and HTML entities alone.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_#&/])#([A-Za-z0-9_]+)`)
+
+// NormalizeTag lowercases tag and strips surrounding spaces and leading #s,
+// so that "Go", "go" and "#go" are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#"))
+}
+
+// NormalizeTags normalizes every tag and drops empty and repeated tags,
+// keeping the first occurrence of each.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// postTags merges the hashtags found in content into the explicit tags of a
+// post and normalizes the result. Explicit tags are expected to have been
+// checked against MaxTagLength already.
+func postTags(explicit []string, content string) []string {
+	tags := slices.Clone(explicit)
+	for _, m := range hashtagPattern.FindAllStringSubmatch(content, -1) {
+		// Hashtags too long to store are left as plain text.
+		if len(m[1]) > MaxTagLength {
+			continue
+		}
+		tags = append(tags, m[1])
+	}
+	return NormalizeTags(tags)
+}
+
+// trendingRefreshLock is the advisory lock key RefreshTrending holds.
+const trendingRefreshLock = 7_340_001
+
+type TagsStore struct {
+	db *sql.DB
+}
+
+// Follow makes posts carrying tag show up in the user's feed. tag must
+// already be normalized.
+func (s *TagsStore) Follow(ctx context.Context, userID int64, tag string) error {
+	query := `INSERT INTO tag_follows (user_id, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, tag)
+	return err
+}
+
+func (s *TagsStore) Unfollow(ctx context.Context, userID int64, tag string) error {
+	query := `DELETE FROM tag_follows WHERE user_id = $1 AND tag = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, tag)
+	return err
+}
+
+// RefreshTrending recomputes the trending tags, comparing how often each tag
+// was used on posts published over the recent window with its rate over the
+// longer baseline window. Only public posts from public accounts count, and
+// a tag needs at least minCount recent uses to trend.
+func (s *TagsStore) RefreshTrending(ctx context.Context, recent, baseline time.Duration, minCount, limit int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		// Only one replica refreshes at a time; the others skip the round
+		// rather than interleave their delete and insert with it.
+		var locked bool
+		if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, trendingRefreshLock).Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM trending_tags`); err != nil {
+			return err
+		}
+
+		// The baseline rate is floored at one use per recent window so that
+		// brand new tags do not get an infinite score.
+		query := `INSERT INTO trending_tags (tag, recent_count, baseline_count, score)
+		SELECT tag, recent_count, baseline_count,
+			recent_count / GREATEST(baseline_count * $1::float8 / $2::float8, 1)
+		FROM (
+			SELECT t.tag,
+				count(*) FILTER (WHERE p.created_at > NOW() - make_interval(secs => $1)) AS recent_count,
+				count(*) AS baseline_count
+			FROM posts p
+			JOIN users u ON u.id = p.user_id
+			CROSS JOIN LATERAL unnest(p.tags) AS t(tag)
+			WHERE p.created_at > NOW() - make_interval(secs => $2) AND
+				p.status = 'published' AND p.deleted_at IS NULL AND
+				p.visibility = 'public' AND NOT u.is_private
+			GROUP BY t.tag
+		) counts
+		WHERE recent_count >= $3
+		ORDER BY 4 DESC
+		LIMIT $4`
+		_, err := tx.ExecContext(ctx, query, recent.Seconds(), baseline.Seconds(), minCount, limit)
+		return err
+	})
+}
+
+// GetTrending returns the trending tags as of the last refresh, highest
+// score first.
+func (s *TagsStore) GetTrending(ctx context.Context, limit int) ([]TrendingTag, error) {
+	query := `SELECT tag, recent_count, baseline_count, score, refreshed_at
+	FROM trending_tags
+	ORDER BY score DESC, recent_count DESC, tag
+	LIMIT $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]TrendingTag, 0)
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.RecentCount, &t.BaselineCount, &t.Score, &t.RefreshedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
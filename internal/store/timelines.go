@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TimelinesStore maintains the materialized feed of every user: one row per
+// post that should show up in that user's feed.
+type TimelinesStore struct {
+	db *sql.DB
+}
+
+// FanOutPost copies a new post into its author's timeline and, unless the
+// author has more than FanOutMaxFollowers followers, into every follower's.
+// Posts from larger accounts are pulled at read time by GetUserFeed instead,
+// and only_me posts never leave the author's timeline.
+func (s *TimelinesStore) FanOutPost(ctx context.Context, postID int64) error {
+	query := `INSERT INTO timelines (user_id, post_id, created_at)
+	SELECT p.user_id, p.id, p.created_at FROM posts p WHERE p.id = $1 AND p.status = 'published' AND p.deleted_at IS NULL
+	UNION ALL
+	SELECT f.follower_id, p.id, p.created_at FROM posts p
+	JOIN followers f ON f.user_id = p.user_id
+	WHERE p.id = $1 AND p.status = 'published' AND p.deleted_at IS NULL AND p.visibility <> 'only_me' AND
+		(SELECT count(*) FROM followers WHERE user_id = p.user_id) <= $2
+	ON CONFLICT DO NOTHING`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, postID, FanOutMaxFollowers)
+	return err
+}
+
+// Backfill adds the most recent posts of a newly followed author to the
+// follower's timeline.
+func (s *TimelinesStore) Backfill(ctx context.Context, userID, authorID int64, limit int) error {
+	query := `INSERT INTO timelines (user_id, post_id, created_at)
+	SELECT $1, p.id, p.created_at FROM posts p
+	WHERE p.user_id = $2 AND p.status = 'published' AND p.deleted_at IS NULL
+	ORDER BY p.created_at DESC
+	LIMIT $3
+	ON CONFLICT DO NOTHING`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, authorID, limit)
+	return err
+}
+
+// RemoveAuthor drops an unfollowed author's posts from the user's timeline.
+func (s *TimelinesStore) RemoveAuthor(ctx context.Context, userID, authorID int64) error {
+	query := `DELETE FROM timelines t
+	USING posts p
+	WHERE t.post_id = p.id AND t.user_id = $1 AND p.user_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, authorID)
+	return err
+}
@@ -2,16 +2,52 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID        int64  `json:"id"`
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	Password  string `json:"-"`
-	CreatedAt string `json:"created_at"`
+	ID        int64    `json:"id"`
+	Username  string   `json:"username"`
+	Email     string   `json:"email"`
+	Password  password `json:"-"`
+	CreatedAt string   `json:"created_at"`
+	IsActive  bool     `json:"is_active"`
+	IsPrivate bool     `json:"is_private"`
+	RoleID    int64    `json:"role_id"`
+	Role      Role     `json:"role"`
+}
+
+type UserStats struct {
+	FollowersCount int `json:"followers_count"`
+	FollowingCount int `json:"following_count"`
+	PostsCount     int `json:"posts_count"`
+}
+
+// password holds the bcrypt hash of a user's password. The plain text is only
+// kept around for the lifetime of the request that set it.
+type password struct {
+	text *string
+	hash []byte
+}
+
+func (p *password) Set(text string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(text), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	p.text = &text
+	p.hash = hash
+	return nil
+}
+
+func (p *password) Compare(text string) error {
+	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
 }
 
 type UsersStore struct {
@@ -19,20 +55,91 @@ type UsersStore struct {
 }
 
 func (s *UsersStore) Create(ctx context.Context, user *User) error {
-	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id, created_at`
-	err := s.db.QueryRowContext(ctx, query, user.Username, user.Email, user.Password).Scan(&user.ID, &user.CreatedAt)
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.create(ctx, tx, user)
+	})
+}
+
+func (s *UsersStore) create(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `INSERT INTO users (username, email, password, is_active, role_id)
+	VALUES ($1, $2, $3, $4, (SELECT id FROM roles WHERE name = $5))
+	RETURNING id, created_at, role_id`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	role := user.Role.Name
+	if role == "" {
+		role = "user"
+	}
+
+	err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash, user.IsActive, role).Scan(&user.ID, &user.CreatedAt, &user.RoleID)
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			switch pqErr.Constraint {
+			case "users_email_key":
+				return ErrDuplicateEmail
+			case "users_username_key":
+				return ErrDuplicateUsername
+			}
+		}
 		return err
 	}
 	return nil
 }
 
 func (s *UsersStore) GetById(ctx context.Context, userID int64) (*User, error) {
-	query := `SELECT id, username, email, created_at FROM users WHERE id = $1`
+	query := `SELECT u.id, u.username, u.email, u.created_at, u.is_active, u.is_private, u.role_id, r.id, r.name, r.level, r.description
+	FROM users u
+	JOIN roles r ON u.role_id = r.id
+	WHERE u.id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	var user User
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.IsPrivate,
+		&user.RoleID,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (s *UsersStore) GetStats(ctx context.Context, userID int64) (*UserStats, error) {
+	query := `SELECT
+		(SELECT count(*) FROM followers WHERE user_id = $1),
+		(SELECT count(*) FROM followers WHERE follower_id = $1),
+		(SELECT count(*) FROM posts WHERE user_id = $1 AND status = 'published' AND deleted_at IS NULL)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	var stats UserStats
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&stats.FollowersCount, &stats.FollowingCount, &stats.PostsCount)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (s *UsersStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `SELECT id, username, email, password, created_at, is_active FROM users WHERE email = $1 AND is_active = TRUE`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 	var user User
-	err := s.db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt)
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.IsActive)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -43,3 +150,110 @@ func (s *UsersStore) GetById(ctx context.Context, userID int64) (*User, error) {
 	}
 	return &user, nil
 }
+
+// CreateAndInvite creates the user and its invitation in a single transaction,
+// so a user row never exists without a way to activate it. send delivers the
+// invitation before the transaction commits; if it fails, nothing is kept.
+func (s *UsersStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, send func() error) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.create(ctx, tx, user); err != nil {
+			return err
+		}
+		if err := s.createUserInvitation(ctx, tx, token, invitationExp, user.ID); err != nil {
+			return err
+		}
+		return send()
+	})
+}
+
+func (s *UsersStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, exp time.Duration, userID int64) error {
+	query := `INSERT INTO user_invitations (token, user_id, expiry) VALUES ($1, $2, $3)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, hashToken(token), userID, time.Now().Add(exp))
+	return err
+}
+
+// Activate marks the user owning the invitation token as active and removes
+// all of its pending invitations.
+func (s *UsersStore) Activate(ctx context.Context, token string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		user, err := s.getUserFromInvitation(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+
+		user.IsActive = true
+		if err := s.update(ctx, tx, user); err != nil {
+			return err
+		}
+
+		return s.deleteUserInvitations(ctx, tx, user.ID)
+	})
+}
+
+func (s *UsersStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `SELECT u.id, u.username, u.email, u.created_at, u.is_active, u.is_private FROM users u
+	JOIN user_invitations ui ON u.id = ui.user_id
+	WHERE ui.token = $1 AND ui.expiry > $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	var user User
+	err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive, &user.IsPrivate)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (s *UsersStore) Update(ctx context.Context, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.update(ctx, tx, user)
+	})
+}
+
+func (s *UsersStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET username = $1, email = $2, is_active = $3, is_private = $4 WHERE id = $5`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.IsActive, user.IsPrivate, user.ID)
+	return err
+}
+
+func (s *UsersStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM user_invitations WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
+
+// PurgeUnactivated removes up to limit users who never activated their
+// account and whose invitations have all expired, freeing their email and
+// username. It returns how many went.
+func (s *UsersStore) PurgeUnactivated(ctx context.Context, limit int) (int64, error) {
+	query := `DELETE FROM users WHERE id IN (
+		SELECT u.id FROM users u
+		WHERE NOT u.is_active AND
+			EXISTS (SELECT 1 FROM user_invitations ui WHERE ui.user_id = u.id) AND
+			NOT EXISTS (SELECT 1 FROM user_invitations ui WHERE ui.user_id = u.id AND ui.expiry > $1)
+		LIMIT $2 FOR UPDATE SKIP LOCKED
+	)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}